@@ -3,6 +3,7 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/ipfs/testground/pkg/api"
@@ -21,6 +22,8 @@ var Commands = []cli.Command{
 	SidecarCommand,
 	DaemonCommand,
 	CollectCommand,
+	CoverageCommand,
+	ArtifactCommand,
 	TerminateCommand,
 	HealthcheckCommand,
 }
@@ -131,12 +134,8 @@ func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 	}
 	comp.Groups[0].Build.Dependencies = make([]api.Dependency, 0, len(dependencies))
 
-	for name, ver := range deps {
-		dep := api.Dependency{
-			Module:  name,
-			Version: ver,
-		}
-		comp.Groups[0].Build.Dependencies = append(comp.Groups[0].Build.Dependencies, dep)
+	for name, val := range deps {
+		comp.Groups[0].Build.Dependencies = append(comp.Groups[0].Build.Dependencies, parseDependency(name, val))
 	}
 
 	switch c := strings.Fields(c.Command.FullName()); c[0] {
@@ -150,3 +149,47 @@ func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 
 	return comp, err
 }
+
+// parseDependency parses the value of a --dep flag for a module, which is
+// either a version, a target@version pair to build against a fork, or a
+// filesystem path (starting with ./, ../ or /, as in go.mod) to build against
+// a local checkout.
+func parseDependency(module, val string) api.Dependency {
+	dep := api.Dependency{Module: module}
+	switch {
+	case val == "." || val == ".." || strings.HasPrefix(val, "./") || strings.HasPrefix(val, "../") || filepath.IsAbs(val):
+		dep.Path = val
+	case strings.Contains(val, "@"):
+		i := strings.LastIndex(val, "@")
+		dep.Target, dep.Version = val[:i], val[i+1:]
+	default:
+		dep.Version = val
+	}
+	return dep
+}
+
+// resolveDependencyPaths returns a copy of the composition with the paths of
+// local dependency overrides made absolute, relative to base. The daemon can't
+// resolve them, as it doesn't know where the client is running from.
+func resolveDependencyPaths(comp api.Composition, base string) (api.Composition, error) {
+	grps := make([]api.Group, len(comp.Groups))
+	for i, grp := range comp.Groups {
+		deps := make(api.Dependencies, len(grp.Build.Dependencies))
+		for j, dep := range grp.Build.Dependencies {
+			if dep.Path != "" && !filepath.IsAbs(dep.Path) {
+				p, err := filepath.Abs(filepath.Join(base, dep.Path))
+				if err != nil {
+					return api.Composition{}, fmt.Errorf("failed to resolve path of dependency %s: %w", dep.Module, err)
+				}
+				dep.Path = p
+			}
+			deps[j] = dep
+		}
+		grp.Build.Dependencies = deps
+		grps[i] = grp
+	}
+
+	// comp is a value, so the caller's composition won't be mutated.
+	comp.Groups = grps
+	return comp, nil
+}
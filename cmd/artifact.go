@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/testground/pkg/artifact"
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/ipfs/testground/pkg/logging"
+
+	"github.com/urfave/cli"
+)
+
+// ArtifactCommand is the specification of the `artifact` command.
+var ArtifactCommand = cli.Command{
+	Name:  "artifact",
+	Usage: "exports and imports build artifacts as portable archives",
+	Subcommands: cli.Commands{
+		cli.Command{
+			Name:      "export",
+			Usage:     "Exports a build artifact (docker image or executable), along with its metadata, to an archive.",
+			Action:    artifactExportCommand,
+			ArgsUsage: "[artifact]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "specifies a named output for the archive",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "import",
+			Usage:     "Imports a build artifact from an archive, and prints the artifact to use in compositions.",
+			Action:    artifactImportCommand,
+			ArgsUsage: "[file]",
+		},
+	},
+}
+
+// unsafeFilenameChars matches the characters of artifact paths that don't
+// belong in a file name.
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func artifactExportCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.NArg() != 1 {
+		_ = cli.ShowSubcommandHelp(c)
+		return errors.New("missing artifact")
+	}
+
+	var (
+		art    = c.Args().First()
+		output = unsafeFilenameChars.ReplaceAllString(filepath.Base(art), "_") + ".tgz"
+	)
+
+	if o := c.String("output"); o != "" {
+		output = o
+	}
+
+	api, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := api.ExportArtifact(ctx, &client.ArtifactExportRequest{Artifact: art})
+	if err != nil {
+		if err == context.Canceled {
+			return fmt.Errorf("interrupted")
+		}
+		return fmt.Errorf("fatal error from daemon: %s", err)
+	}
+	defer resp.Close()
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	// Check that we got the whole archive, as the connection may have been
+	// cut short.
+	_, err = io.Copy(file, resp)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = artifact.Verify(file)
+	}
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("failed to export artifact: %w", err)
+	}
+
+	logging.S().Infof("created file: %s", output)
+
+	return nil
+}
+
+func artifactImportCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.NArg() != 1 {
+		_ = cli.ShowSubcommandHelp(c)
+		return errors.New("missing archive file")
+	}
+
+	file, err := os.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	api, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := api.ImportArtifact(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	meta, err := client.ParseImportArtifactResponse(r)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("plan: %s\n", meta.Plan)
+	fmt.Printf("builder: %s\n", meta.BuilderID)
+	fmt.Printf("artifact: %s\n", meta.ArtifactPath)
+
+	if len(meta.Dependencies) > 0 {
+		deps := make([]string, 0, len(meta.Dependencies))
+		for mod, ver := range meta.Dependencies {
+			deps = append(deps, mod+" "+ver)
+		}
+		sort.Strings(deps)
+		fmt.Printf("dependencies:\n\t%s\n", strings.Join(deps, "\n\t"))
+	}
+
+	return nil
+}
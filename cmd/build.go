@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/ipfs/testground/pkg/api"
 	"github.com/ipfs/testground/pkg/client"
@@ -42,11 +43,11 @@ var BuildCommand = cli.Command{
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "builder, b",
-					Usage: "specifies the builder to use; values include: 'docker:go', 'exec:go'",
+					Usage: "specifies the builder to use; values include: 'docker:go', 'exec:go', 'docker:generic'",
 				},
 				cli.StringSliceFlag{
 					Name:  "dep, d",
-					Usage: "set a dependency mapping",
+					Usage: "set a dependency override, as module=version, module=target@version (fork), or module=path (local checkout)",
 				},
 				cli.StringSliceFlag{
 					Name:  "build-cfg",
@@ -108,7 +109,18 @@ func doBuild(c *cli.Context, comp *api.Composition) ([]api.BuildOutput, error) {
 		return nil, err
 	}
 
-	req := &client.BuildRequest{Composition: *comp}
+	// Relative paths of local dependency overrides are relative to the
+	// composition file, if any, or the working directory.
+	base := "."
+	if file := c.String("file"); file != "" {
+		base = filepath.Dir(file)
+	}
+	rcomp, err := resolveDependencyPaths(*comp, base)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &client.BuildRequest{Composition: rcomp}
 	resp, err := cl.Build(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("fatal error from daemon: %s", err)
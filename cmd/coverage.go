@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/ipfs/testground/pkg/coverage"
+	"github.com/ipfs/testground/pkg/logging"
+
+	"github.com/urfave/cli"
+)
+
+// CoverageCommand is the specification of the `coverage` command.
+var CoverageCommand = cli.Command{
+	Name:      "coverage",
+	Usage:     "Merges the coverage data of the instances of a run built with coverage = true into a single profile",
+	Action:    coverageCommand,
+	ArgsUsage: "[run_id]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:     "runner, r",
+			Usage:    "specifies the runner that performed the run; values include: 'local:exec', 'local:docker', 'cluster:k8s'",
+			Required: true,
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "specifies a named output for the coverage profile",
+		},
+	},
+}
+
+func coverageCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.NArg() != 1 {
+		_ = cli.ShowSubcommandHelp(c)
+		return errors.New("missing run id")
+	}
+
+	var (
+		id     = c.Args().First()
+		runner = c.String("runner")
+		output = id + ".cov"
+	)
+
+	if o := c.String("output"); o != "" {
+		output = o
+	}
+
+	api, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir("", "coverage")
+	if err != nil {
+		return fmt.Errorf("failed while creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Collect the outputs of the run, which carry the coverage data.
+	req := &client.OutputsRequest{
+		Runner: runner,
+		RunID:  id,
+	}
+
+	resp, err := api.CollectOutputs(ctx, req)
+	if err != nil {
+		if err == context.Canceled {
+			return fmt.Errorf("interrupted")
+		}
+		return fmt.Errorf("fatal error from daemon: %s", err)
+	}
+	defer resp.Close()
+
+	archive, err := os.Create(filepath.Join(tmp, "outputs.zip"))
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	size, err := io.Copy(archive, resp)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return fmt.Errorf("failed to open outputs of run %s: %w", id, err)
+	}
+
+	dirs, err := coverage.ExtractZip(zr, tmp)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("no coverage data found in the outputs of run %s; was it built with coverage = true?", id)
+	}
+
+	if err := coverage.Merge(ctx, dirs, output); err != nil {
+		return err
+	}
+
+	logging.S().Infow("merged coverage profile", "file", output, "instances", len(dirs))
+	return nil
+}
@@ -2,7 +2,12 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
 
 	"github.com/ipfs/testground/pkg/client"
 	"github.com/urfave/cli"
@@ -18,9 +23,20 @@ var HealthcheckCommand = cli.Command{
 			Usage: "should try to fix the preconditions",
 		},
 		cli.StringFlag{
-			Name:     "runner",
-			Usage:    "specifies the runner to use; values include: 'local:exec', 'local:docker', 'cluster:k8s'",
-			Required: true,
+			Name:  "runner",
+			Usage: "specifies the runner to use; values include: 'local:exec', 'local:docker', 'cluster:k8s', 'cluster:swarm'",
+		},
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "checks every runner and builder that supports healthchecks",
+		},
+		cli.GenericFlag{
+			Name:  "format",
+			Usage: "output format; values include: 'text', 'json'",
+			Value: &EnumValue{
+				Allowed: []string{"text", "json"},
+				Default: "text",
+			},
 		},
 	},
 }
@@ -32,8 +48,15 @@ func healthcheckCommand(c *cli.Context) error {
 	var (
 		runner = c.String("runner")
 		fix    = c.Bool("fix")
+		all    = c.Bool("all")
+		format = c.Generic("format").(*EnumValue).String()
 	)
 
+	if (runner == "") == !all {
+		_ = cli.ShowSubcommandHelp(c)
+		return errors.New("exactly one of --runner or --all must be specified")
+	}
+
 	api, err := setupClient(c)
 	if err != nil {
 		return err
@@ -42,19 +65,66 @@ func healthcheckCommand(c *cli.Context) error {
 	r, err := api.Healthcheck(ctx, &client.HealthcheckRequest{
 		Runner: runner,
 		Fix:    fix,
+		All:    all,
 	})
 	if err != nil {
 		return err
 	}
 	defer r.Close()
 
-	resp, err := client.ParseHealthcheckResponse(r)
-	if err != nil {
-		return err
+	// Keep stdout clean for machine-readable output.
+	var progress io.Writer = os.Stdout
+	if format == "json" {
+		progress = os.Stderr
 	}
 
-	fmt.Printf("finished checking runner %s\n", runner)
-	fmt.Println(resp.String())
+	var resps client.HealthcheckAllResponse
+	if all {
+		resps, err = client.ParseHealthcheckAllResponse(r, progress)
+		if err != nil {
+			return err
+		}
+	} else {
+		resp, err := client.ParseHealthcheckResponse(r, progress)
+		if err != nil {
+			return err
+		}
+		resps = client.HealthcheckAllResponse{runner: &resp}
+	}
+
+	ids := make([]string, 0, len(resps))
+	for id := range resps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
 
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if all {
+			err = enc.Encode(resps)
+		} else {
+			err = enc.Encode(resps[runner])
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		for _, id := range ids {
+			fmt.Printf("finished checking %s\n", id)
+			fmt.Println(resps[id].String())
+		}
+	}
+
+	var unhealthy []string
+	for _, id := range ids {
+		if !resps[id].Healthy() {
+			unhealthy = append(unhealthy, id)
+		}
+	}
+	if len(unhealthy) > 0 {
+		return cli.NewExitError(fmt.Sprintf("unhealthy: %v", unhealthy), 2)
+	}
 	return nil
 }
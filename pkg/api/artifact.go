@@ -0,0 +1,20 @@
+package api
+
+import "time"
+
+// ArtifactMetadata describes a build artifact, so that it can be exported from
+// one testground installation and imported into another.
+type ArtifactMetadata struct {
+	// BuilderID is the ID of the builder that produced the artifact.
+	BuilderID string `json:"builder_id"`
+	// Plan is the name of the test plan the artifact was built from.
+	Plan string `json:"plan"`
+	// ArtifactPath is the artifact, as referenced by the Run.Artifact field of
+	// a composition.
+	ArtifactPath string `json:"artifact_path"`
+	// Dependencies are the dependencies reported by the build, see
+	// BuildOutput.
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	// CreatedAt is the time at which the artifact was built.
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -36,11 +36,12 @@ type BuildInput struct {
 	// Selectors specifies any source selection strings to be sent to the
 	// builder. In the case of go builders, this field maps to build tags.
 	Selectors []string
-	// Dependencies are the versions of upstream dependencies we want to build
+	// Dependencies are the overrides of upstream dependencies we want to build
 	// against. For a go build, this could be e.g.:
 	//  github.com/ipfs/go-ipfs=v0.4.22
-	//  github.com/libp2p/go-libp2p=v0.2.8
-	Dependencies map[string]string
+	//  github.com/libp2p/go-libp2p=github.com/myuser/go-libp2p@v0.2.8
+	//  github.com/libp2p/go-libp2p-core=/home/me/src/go-libp2p-core
+	Dependencies Dependencies
 	// BuildConfig is the configuration of the build job sourced from the test
 	// plan manifest, coalesced with any user-provided overrides.
 	BuildConfig interface{}
@@ -55,6 +56,7 @@ type BuildOutput struct {
 	ArtifactPath string
 	// Dependencies is a map of modules (as keys) to versions (as values),
 	// containing the collapsed transitive upstream dependency set of this
-	// build.
+	// build. Builders that can't resolve the dependency set report the
+	// overrides they applied instead, as returned by Dependencies.AsMap.
 	Dependencies map[string]string
 }
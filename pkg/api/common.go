@@ -1,7 +1,12 @@
 package api
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/testground/pkg/config"
 )
 
 // Directories providers accessors to directories managed by the testground
@@ -36,3 +41,44 @@ func EnumerateOverridableFields(typ reflect.Type) (out []string) {
 	}
 	return out
 }
+
+// ValidateOverrides checks that a set of configuration overrides, such as the
+// build_config and run_config of a composition, only sets fields of the struct
+// type that can be overridden (see EnumerateOverridableFields).
+func ValidateOverrides(typ reflect.Type, overrides map[string]interface{}) error {
+	var (
+		overridable = EnumerateOverridableFields(typ)
+		known       = config.ConfigKeys(typ)
+		keys        = make([]string, 0, len(overrides))
+		msgs        []string
+	)
+
+	for k := range overrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		switch {
+		case contains(overridable, k) || k == config.EnabledKey:
+		case contains(known, k):
+			msgs = append(msgs, fmt.Sprintf("configuration key %q cannot be overridden", k))
+		default:
+			msgs = append(msgs, fmt.Sprintf("unknown configuration key %q%s", k, config.DidYouMean(k, overridable)))
+		}
+	}
+
+	if len(msgs) > 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
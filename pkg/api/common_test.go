@@ -0,0 +1,35 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type overridesConfig struct {
+	Enabled   bool
+	GoVersion string `toml:"go_version" overridable:"yes"`
+	Endpoint  string `toml:"endpoint"`
+}
+
+func TestValidateOverrides(t *testing.T) {
+	typ := reflect.TypeOf(overridesConfig{})
+
+	if err := ValidateOverrides(typ, map[string]interface{}{"go_version": "1.14", "enabled": true}); err != nil {
+		t.Fatalf("expected overrides to be valid, got: %s", err)
+	}
+
+	err := ValidateOverrides(typ, map[string]interface{}{"endpoint": "tcp://host", "go_verison": "1.14"})
+	if err == nil {
+		t.Fatal("expected overrides to be rejected")
+	}
+
+	for _, s := range []string{
+		`configuration key "endpoint" cannot be overridden`,
+		`unknown configuration key "go_verison"; did you mean "go_version"?`,
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected error to contain %q, got: %s", s, err)
+		}
+	}
+}
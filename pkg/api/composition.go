@@ -3,13 +3,18 @@ package api
 import (
 	"fmt"
 	"math"
+	"sort"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+
+	"github.com/ipfs/testground/sdk/sync"
 )
 
 var compositionValidator = func() *validator.Validate {
 	v := validator.New()
 	v.RegisterStructValidation(ValidateInstances, &Instances{})
+	v.RegisterStructValidation(ValidateDependency, &Dependency{})
 	return v
 }()
 
@@ -105,12 +110,35 @@ type Build struct {
 	// Dependencies specifies any upstream dependency overrides to apply to this
 	// build.
 	Dependencies Dependencies `toml:"dependencies" json:"dependencies"`
+
+	// BuildConfig specifies build configuration overrides for this group,
+	// coalesced over Global.BuildConfig. Only fields that the builder marks as
+	// overridable can be set.
+	BuildConfig map[string]interface{} `toml:"build_config" json:"build_config,omitempty"`
+}
+
+// BuildKey returns a key identifying the selectors and dependencies of this
+// build; along with the effective build configuration, they determine the
+// resulting artifact. The order of selectors and dependencies is irrelevant.
+func (b Build) BuildKey() string {
+	sels := append([]string(nil), b.Selectors...)
+	sort.Strings(sels)
+
+	deps := make([]string, 0, len(b.Dependencies))
+	for _, dep := range b.Dependencies {
+		deps = append(deps, dep.String())
+	}
+	sort.Strings(deps)
+
+	return strings.Join(sels, ",") + "|" + strings.Join(deps, ",")
 }
 
+// AsMap returns the overrides as a map of modules (as keys) to what they're
+// overridden with (as values): a version, target@version, or path.
 func (d Dependencies) AsMap() map[string]string {
 	m := make(map[string]string, len(d))
 	for _, dep := range d {
-		m[dep.Module] = dep.Version
+		m[dep.Module] = dep.Override()
 	}
 	return m
 }
@@ -122,14 +150,48 @@ type Run struct {
 	// TestParams specify the test parameters to pass down to instances of this
 	// group.
 	TestParams map[string]string `toml:"test_params" json:"test_params"`
+
+	// NAT is the type of NAT the sidecar puts the instances of this group
+	// behind on the data network: none (default), full-cone, restricted-cone,
+	// port-restricted-cone or symmetric.
+	NAT string `toml:"nat" json:"nat,omitempty"`
 }
 
 type Dependency struct {
 	// Module is the module name/path for the import to be overridden.
 	Module string `toml:"module" json:"module" validate:"required"`
 
-	// Version is the override version.
-	Version string `toml:"version" json:"version" validate:"required"`
+	// Version is the override version. It is required unless Path is set.
+	Version string `toml:"version" json:"version"`
+
+	// Target is an alternative module path to replace Module with, e.g. a fork.
+	// If empty, Module itself is used.
+	Target string `toml:"target" json:"target,omitempty"`
+
+	// Path is the filesystem path of a local checkout of the module to build
+	// against. It's mutually exclusive with Version and Target. Relative paths
+	// are resolved by the client against the directory of the composition file,
+	// or the working directory when there isn't one.
+	Path string `toml:"path" json:"path,omitempty"`
+}
+
+// String returns the override in the form module=version,
+// module=target@version, or module=path.
+func (d Dependency) String() string {
+	return d.Module + "=" + d.Override()
+}
+
+// Override returns what the module is overridden with, in the form version,
+// target@version, or path.
+func (d Dependency) Override() string {
+	switch {
+	case d.Path != "":
+		return d.Path
+	case d.Target != "":
+		return d.Target + "@" + d.Version
+	default:
+		return d.Version
+	}
 }
 
 // ValidateForBuild validates that this Composition is correct for a build.
@@ -153,6 +215,9 @@ func (c *Composition) ValidateForRun() error {
 	total, cum := c.Global.TotalInstances, uint(0)
 	for i := range c.Groups {
 		g := &(c.Groups[i])
+		if _, err := sync.ParseNATType(g.Run.NAT); err != nil {
+			return fmt.Errorf("group %s: %w", g.ID, err)
+		}
 		if g.calculatedInstanceCnt = g.Instances.Count; g.calculatedInstanceCnt == 0 {
 			g.calculatedInstanceCnt = uint(math.Round(g.Instances.Percentage * float64(total)))
 		}
@@ -196,3 +261,19 @@ func ValidateInstances(sl validator.StructLevel) {
 	sl.ReportError(instances.Count, "count", "Count", "count_or_percentage", "")
 	sl.ReportError(instances.Percentage, "percentage", "Percentage", "count_or_percentage", "")
 }
+
+// ValidateDependency validates that a dependency override either points to a
+// version, optionally of a different target module, or to a local path, but
+// not both.
+func ValidateDependency(sl validator.StructLevel) {
+	dep := sl.Current().Interface().(Dependency)
+
+	switch {
+	case dep.Path == "" && dep.Version == "":
+		sl.ReportError(dep.Version, "version", "Version", "version_or_path", "")
+	case dep.Path != "" && dep.Version != "":
+		sl.ReportError(dep.Path, "path", "Path", "version_or_path", "")
+	case dep.Path != "" && dep.Target != "":
+		sl.ReportError(dep.Target, "target", "Target", "excluded_with_path", "")
+	}
+}
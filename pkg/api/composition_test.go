@@ -0,0 +1,95 @@
+package api
+
+import "testing"
+
+func TestBuildKey(t *testing.T) {
+	a := Build{
+		Selectors: []string{"foo", "bar"},
+		Dependencies: Dependencies{
+			{Module: "github.com/ipfs/go-cid", Version: "v0.0.5"},
+			{Module: "github.com/libp2p/go-libp2p", Target: "github.com/me/go-libp2p", Version: "v0.5.0"},
+		},
+	}
+
+	// same inputs, in a different order.
+	b := Build{
+		Selectors: []string{"bar", "foo"},
+		Dependencies: Dependencies{
+			{Module: "github.com/libp2p/go-libp2p", Target: "github.com/me/go-libp2p", Version: "v0.5.0"},
+			{Module: "github.com/ipfs/go-cid", Version: "v0.0.5"},
+		},
+	}
+
+	if a.BuildKey() != b.BuildKey() {
+		t.Fatalf("expected equal build keys, got %q and %q", a.BuildKey(), b.BuildKey())
+	}
+
+	// the order of selectors must not leak into the build.
+	if a.Selectors[0] != "foo" {
+		t.Fatalf("BuildKey must not modify the selectors")
+	}
+
+	for _, c := range []Build{
+		{},
+		{Selectors: []string{"foo"}},
+		{Dependencies: Dependencies{{Module: "github.com/ipfs/go-cid", Version: "v0.0.5"}}},
+		{Dependencies: Dependencies{{Module: "github.com/ipfs/go-cid", Path: "/src/go-cid"}}},
+	} {
+		if c.BuildKey() == a.BuildKey() {
+			t.Errorf("expected build keys of %+v and %+v to differ", c, a)
+		}
+	}
+}
+
+func TestDependenciesAsMap(t *testing.T) {
+	deps := Dependencies{
+		{Module: "github.com/ipfs/go-cid", Version: "v0.0.5"},
+		{Module: "github.com/libp2p/go-libp2p", Target: "github.com/me/go-libp2p", Version: "v0.5.0"},
+		{Module: "github.com/ipfs/go-ipfs", Path: "/src/go-ipfs"},
+	}
+
+	expected := map[string]string{
+		"github.com/ipfs/go-cid":      "v0.0.5",
+		"github.com/libp2p/go-libp2p": "github.com/me/go-libp2p@v0.5.0",
+		"github.com/ipfs/go-ipfs":     "/src/go-ipfs",
+	}
+
+	m := deps.AsMap()
+	if len(m) != len(expected) {
+		t.Fatalf("expected %d dependencies, got %v", len(expected), m)
+	}
+	for mod, v := range expected {
+		if m[mod] != v {
+			t.Errorf("expected %s to be overridden with %q, got %q", mod, v, m[mod])
+		}
+	}
+}
+
+func TestValidateNAT(t *testing.T) {
+	comp := func(nat string) *Composition {
+		return &Composition{
+			Global: Global{
+				Plan:           "network",
+				Case:           "ping-pong",
+				TotalInstances: 1,
+				Builder:        "docker:go",
+				Runner:         "local:docker",
+			},
+			Groups: []Group{{
+				ID:        "single",
+				Instances: Instances{Count: 1},
+				Run:       Run{NAT: nat},
+			}},
+		}
+	}
+
+	for _, nat := range []string{"", "none", "full-cone", "restricted-cone", "port-restricted-cone", "symmetric"} {
+		if err := comp(nat).ValidateForRun(); err != nil {
+			t.Errorf("expected NAT type %q to be valid, got: %s", nat, err)
+		}
+	}
+
+	if err := comp("cone").ValidateForRun(); err == nil {
+		t.Error("expected an unknown NAT type to be rejected")
+	}
+}
@@ -21,6 +21,9 @@ type Engine interface {
 	DoCollectOutputs(ctx context.Context, runner string, runID string, w io.Writer) error
 	DoTerminate(ctx context.Context, runner string, w io.Writer) error
 	DoHealthcheck(ctx context.Context, runner string, fix bool, w io.Writer) (*HealthcheckReport, error)
+	DoHealthcheckAll(ctx context.Context, fix bool, w io.Writer) (map[string]*HealthcheckReport, error)
+	DoExportArtifact(ctx context.Context, artifact string, w io.Writer) error
+	DoImportArtifact(ctx context.Context, r io.Reader, w io.Writer) (*ArtifactMetadata, error)
 
 	EnvConfig() config.EnvConfig
 	Context() context.Context
@@ -33,21 +33,21 @@ var (
 // convey the result of checks and fixes.
 type HealthcheckItem struct {
 	// Name is a short name describing this item.
-	Name string
+	Name string `json:"name"`
 	// Status is the status of this check/fix.
-	Status HealthcheckStatus
+	Status HealthcheckStatus `json:"status"`
 	// Message optionally contains any human-readable messages to be presented
 	// to the user.
-	Message string
+	Message string `json:"message"`
 }
 
 type HealthcheckReport struct {
 	// Checks enumerates the outcomes of the health checks.
-	Checks []HealthcheckItem
+	Checks []HealthcheckItem `json:"checks"`
 
 	// Fixes enumerates the outcomes of the fixes applied during fix, if a
 	// fix was requested.
-	Fixes []HealthcheckItem
+	Fixes []HealthcheckItem `json:"fixes,omitempty"`
 }
 
 func (hr *HealthcheckReport) ChecksSucceeded() bool {
@@ -68,6 +68,27 @@ func (hr *HealthcheckReport) FixesSucceeded() bool {
 	return true
 }
 
+// Healthy returns true if every check succeeded, or if every check that
+// failed or aborted was remedied by a successful fix of the same name.
+func (hr *HealthcheckReport) Healthy() bool {
+	for _, c := range hr.Checks {
+		if c.Status != HealthcheckStatusFailed && c.Status != HealthcheckStatusAborted {
+			continue
+		}
+		fixed := false
+		for _, f := range hr.Fixes {
+			if f.Name == c.Name && f.Status == HealthcheckStatusOK {
+				fixed = true
+				break
+			}
+		}
+		if !fixed {
+			return false
+		}
+	}
+	return true
+}
+
 func (hr *HealthcheckReport) String() string {
 	b := new(strings.Builder)
 
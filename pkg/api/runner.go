@@ -76,6 +76,10 @@ type RunGroup struct {
 
 	// Parameters are the runtime parameters to the test case.
 	Parameters map[string]string
+
+	// NAT is the type of NAT the sidecar puts the instances behind; empty if
+	// none.
+	NAT string
 }
 
 type RunOutput struct {
@@ -0,0 +1,255 @@
+package artifact
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/docker"
+
+	"github.com/docker/docker/client"
+)
+
+// Export writes the archive of the artifact described by meta to w.
+func Export(ctx context.Context, meta *api.ArtifactMetadata, w io.Writer) error {
+	var (
+		payload string
+		name    string
+	)
+
+	switch {
+	case isDocker(meta.BuilderID):
+		// docker save streams the image without announcing its size, which the
+		// tar header needs; spool it to a temp file first.
+		f, err := saveImage(ctx, meta.ArtifactPath)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f)
+
+		payload, name = f, imageEntry
+
+	case isExec(meta.BuilderID):
+		payload, name = meta.ArtifactPath, executableEntry
+
+	default:
+		return fmt.Errorf("exporting artifacts of builder %s is not supported", meta.BuilderID)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:    metadataEntry,
+		Mode:    0644,
+		Size:    int64(len(b)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return err
+	}
+
+	if err := writeFile(tw, name, payload); err != nil {
+		return fmt.Errorf("failed to write artifact %s: %w", meta.ArtifactPath, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// Import reads an archive produced by Export from r, and makes the artifact
+// available to runners: docker images are loaded into the docker daemon, and
+// executables are written to the work dir. It records and returns the
+// metadata of the artifact, whose ArtifactPath can be used in compositions.
+func Import(ctx context.Context, r io.Reader, workdir string, output io.Writer) (*api.ArtifactMetadata, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not an artifact archive: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("not an artifact archive: %w", err)
+	}
+	if hdr.Name != metadataEntry {
+		return nil, fmt.Errorf("not an artifact archive: expected %s, got %s", metadataEntry, hdr.Name)
+	}
+
+	var meta api.ArtifactMetadata
+	if err := json.NewDecoder(tr).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("failed to decode artifact metadata: %w", err)
+	}
+
+	if hdr, err = tr.Next(); err != nil {
+		return nil, fmt.Errorf("artifact archive has no payload: %w", err)
+	}
+
+	switch {
+	case isDocker(meta.BuilderID) && hdr.Name == imageEntry:
+		if err := loadImage(ctx, tr, output); err != nil {
+			return nil, err
+		}
+
+	case isExec(meta.BuilderID) && hdr.Name == executableEntry:
+		path := filepath.Join(workdir, filepath.Base(meta.ArtifactPath))
+		if err := writeExecutable(path, tr); err != nil {
+			return nil, fmt.Errorf("failed to write executable: %w", err)
+		}
+		meta.ArtifactPath = path
+
+	default:
+		return nil, fmt.Errorf("unexpected payload %s for an artifact of builder %s", hdr.Name, meta.BuilderID)
+	}
+
+	if err := Record(workdir, &meta); err != nil {
+		return nil, fmt.Errorf("failed to record artifact metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// Verify reads an archive produced by Export from r, and checks that it's
+// complete: that it holds the metadata and the payload of an artifact, and
+// that neither the tar nor the gzip stream is truncated.
+func Verify(r io.Reader) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("not an artifact archive: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("corrupt artifact archive: %w", err)
+		}
+		if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+			return fmt.Errorf("corrupt artifact archive: %s: %w", hdr.Name, err)
+		}
+		names = append(names, hdr.Name)
+	}
+
+	// the gzip checksum is verified once the stream is drained.
+	if _, err := io.Copy(ioutil.Discard, gr); err != nil {
+		return fmt.Errorf("corrupt artifact archive: %w", err)
+	}
+
+	if len(names) != 2 || names[0] != metadataEntry {
+		return fmt.Errorf("incomplete artifact archive: entries %v", names)
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, name string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func writeExecutable(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func newDockerClient() (*client.Client, error) {
+	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+}
+
+// saveImage saves a docker image to a temp file, and returns its path.
+func saveImage(ctx context.Context, image string) (string, error) {
+	cli, err := newDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	rc, err := cli.ImageSave(ctx, []string{image})
+	if err != nil {
+		return "", fmt.Errorf("failed to save image %s: %w", image, err)
+	}
+	defer rc.Close()
+
+	f, err := ioutil.TempFile("", "artifact-image")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, rc); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to save image %s: %w", image, err)
+	}
+	return f.Name(), nil
+}
+
+// loadImage loads a docker image saved by saveImage into the docker daemon.
+// Images keep their ID, and their tags if they were saved by reference.
+func loadImage(ctx context.Context, r io.Reader, output io.Writer) error {
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	resp, err := cli.ImageLoad(ctx, r, true)
+	if err != nil {
+		return fmt.Errorf("failed to load image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return docker.PipeOutput(resp.Body, output)
+}
@@ -0,0 +1,125 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLookupUnknown(t *testing.T) {
+	workdir := tempDir(t)
+	defer os.RemoveAll(workdir)
+
+	if _, err := Lookup(workdir, "sha256:abc"); !errors.Is(err, ErrUnknownArtifact) {
+		t.Fatalf("expected ErrUnknownArtifact, got: %v", err)
+	}
+}
+
+func TestExportImportExecutable(t *testing.T) {
+	src, dst := tempDir(t), tempDir(t)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(dst)
+
+	bin := filepath.Join(src, "exec-go--placebo-abc")
+	if err := ioutil.WriteFile(bin, []byte("#!/bin/sh\necho ok\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := &api.ArtifactMetadata{
+		BuilderID:    "exec:go",
+		Plan:         "placebo",
+		ArtifactPath: bin,
+		Dependencies: map[string]string{"github.com/ipfs/go-cid": "v0.0.5"},
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	if err := Record(src, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := Lookup(src, bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Export(context.Background(), recorded, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := Import(context.Background(), &buf, dst, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := *meta
+	expected.ArtifactPath = filepath.Join(dst, "exec-go--placebo-abc")
+	if !reflect.DeepEqual(*imported, expected) {
+		t.Fatalf("expected metadata %+v, got %+v", expected, *imported)
+	}
+
+	fi, err := os.Stat(imported.ArtifactPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm()&0100 == 0 {
+		t.Fatalf("expected imported artifact to be executable, mode: %s", fi.Mode())
+	}
+
+	// the imported artifact can be exported again.
+	if _, err := Lookup(dst, imported.ArtifactPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportInvalidArchive(t *testing.T) {
+	workdir := tempDir(t)
+	defer os.RemoveAll(workdir)
+
+	if _, err := Import(context.Background(), bytes.NewReader([]byte("garbage")), workdir, ioutil.Discard); err == nil {
+		t.Fatal("expected an error when importing an invalid archive")
+	}
+}
+
+func TestVerifyTruncatedArchive(t *testing.T) {
+	src := tempDir(t)
+	defer os.RemoveAll(src)
+
+	bin := filepath.Join(src, "exec-go--placebo-abc")
+	if err := ioutil.WriteFile(bin, bytes.Repeat([]byte("x"), 64<<10), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	meta := &api.ArtifactMetadata{BuilderID: "exec:go", Plan: "placebo", ArtifactPath: bin}
+	if err := Export(context.Background(), meta, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("expected a complete archive to verify, got: %s", err)
+	}
+
+	for _, n := range []int{buf.Len() / 2, buf.Len() - 4} {
+		if err := Verify(bytes.NewReader(buf.Bytes()[:n])); err == nil {
+			t.Errorf("expected an archive truncated to %d of %d bytes to fail", n, buf.Len())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package artifact exports build artifacts as portable archives, and imports
+// them back, so that test plans can be built on one machine and run on
+// another.
+//
+// An archive is a gzipped tarball holding two entries: metadata.json, the
+// api.ArtifactMetadata of the artifact, followed by its payload. The payload
+// of docker:* artifacts is image.tar, as produced by `docker save`. The
+// payload of exec:* artifacts is the executable itself.
+//
+// Metadata is recorded by the engine for every successful build, under the
+// artifacts directory of the work dir; only recorded artifacts can be
+// exported.
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/testground/pkg/api"
+)
+
+const (
+	metadataEntry   = "metadata.json"
+	imageEntry      = "image.tar"
+	executableEntry = "executable"
+)
+
+// ErrUnknownArtifact is returned when no metadata has been recorded for an
+// artifact.
+var ErrUnknownArtifact = errors.New("unknown artifact")
+
+// Record records the metadata of an artifact in the work dir.
+func Record(workdir string, meta *api.ArtifactMetadata) error {
+	p := metadataPath(workdir, meta.ArtifactPath)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, b, 0644)
+}
+
+// Lookup returns the metadata recorded for an artifact in the work dir, or
+// ErrUnknownArtifact if there's none.
+func Lookup(workdir string, artifact string) (*api.ArtifactMetadata, error) {
+	b, err := ioutil.ReadFile(metadataPath(workdir, artifact))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s; only artifacts built or imported by this daemon can be exported", ErrUnknownArtifact, artifact)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var meta api.ArtifactMetadata
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata of artifact %s: %w", artifact, err)
+	}
+	return &meta, nil
+}
+
+// metadataPath returns the path of the metadata file of an artifact. Artifact
+// paths can be image IDs, image references or file paths, so they are hashed
+// into a file name.
+func metadataPath(workdir string, artifact string) string {
+	h := sha256.Sum256([]byte(artifact))
+	return filepath.Join(workdir, "artifacts", hex.EncodeToString(h[:])+".json")
+}
+
+// isDocker returns whether the artifacts produced by a builder are docker
+// images.
+func isDocker(builder string) bool {
+	return strings.HasPrefix(builder, "docker:")
+}
+
+// isExec returns whether the artifacts produced by a builder are executables.
+func isExec(builder string) bool {
+	return strings.HasPrefix(builder, "exec:")
+}
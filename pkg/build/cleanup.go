@@ -0,0 +1,119 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"go.uber.org/zap"
+)
+
+// stepImageRe matches the line with which the docker builder reports the image
+// resulting from a build step.
+var stepImageRe = regexp.MustCompile(`^ ---> ([0-9a-f]{12,64})$`)
+
+// ImageTracker is a writer that records the images a docker build creates,
+// from its output, which it passes through to the underlying writer.
+//
+// Steps that resolve to a cached image, and FROM steps, which resolve to a
+// base image, don't create any image.
+type ImageTracker struct {
+	w io.Writer
+
+	lk     sync.Mutex
+	line   bytes.Buffer
+	from   bool
+	cached bool
+	images []string
+}
+
+var _ io.Writer = (*ImageTracker)(nil)
+
+// NewImageTracker returns an ImageTracker that writes the build output to w.
+func NewImageTracker(w io.Writer) *ImageTracker {
+	return &ImageTracker{w: w}
+}
+
+func (t *ImageTracker) Write(p []byte) (int, error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	for rest := p; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			t.line.Write(rest)
+			break
+		}
+		t.line.Write(rest[:i])
+		t.scan(strings.TrimRight(t.line.String(), "\r"))
+		t.line.Reset()
+		rest = rest[i+1:]
+	}
+	return t.w.Write(p)
+}
+
+func (t *ImageTracker) scan(line string) {
+	switch {
+	case strings.HasPrefix(line, "Step "):
+		// e.g. "Step 1/20 : FROM golang:1.13.4-buster"
+		instr := line[strings.Index(line, ":")+1:]
+		t.from = strings.HasPrefix(strings.ToUpper(strings.TrimSpace(instr)), "FROM ")
+		t.cached = false
+	case line == " ---> Using cache":
+		t.cached = true
+	default:
+		m := stepImageRe.FindStringSubmatch(line)
+		if m == nil || t.from || t.cached {
+			return
+		}
+		t.images = append(t.images, m[1])
+	}
+}
+
+// Images returns the images the build has created so far, in the order it
+// created them.
+func (t *ImageTracker) Images() []string {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	return append([]string(nil), t.images...)
+}
+
+// RemoveBuildImages cleans up after a failed or cancelled docker build: it
+// removes the image tagged with the build ID, if it was created, and the
+// images the build created, as recorded by its ImageTracker, which are the
+// leftovers of unfinished build stages.
+//
+// Images created by the build but already in use, e.g. as the cache of a
+// concurrent build, can't be removed without forcing it, so they're left
+// alone. The cleanup uses its own context, as the build's is usually done by
+// now.
+func RemoveBuildImages(log *zap.SugaredLogger, cli *client.Client, id string, images []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	// only remove the images we know this build created; their parents may
+	// be the cache of other builds.
+	var opts types.ImageRemoveOptions
+	if _, err := cli.ImageRemove(ctx, id, opts); err != nil && !client.IsErrNotFound(err) {
+		log.Warnw("failed to remove image of failed build", "image", id, "err", err)
+	}
+
+	// remove children before their parents.
+	for i := len(images) - 1; i >= 0; i-- {
+		img := images[i]
+		if _, err := cli.ImageRemove(ctx, img, opts); err != nil {
+			if !client.IsErrNotFound(err) {
+				log.Debugw("not removing image of failed build", "image", img, "err", err)
+			}
+			continue
+		}
+		log.Debugw("removed image of failed build", "image", img)
+	}
+}
@@ -0,0 +1,51 @@
+package build
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestImageTracker(t *testing.T) {
+	output := `Step 1/6 : FROM golang:1.13.4-buster
+ ---> 3f8e1d4ab2ec
+Step 2/6 : ARG GO_PROXY=direct
+ ---> Using cache
+ ---> 5d2c1e8f0a11
+Step 3/6 : COPY /plan/go.mod /plan/
+ ---> 9b0c7e6d5a42
+Step 4/6 : RUN cd /plan && go mod download
+ ---> Running in 0e1f2a3b4c5d
+Removing intermediate container 0e1f2a3b4c5d
+ ---> 7a6b5c4d3e2f
+Step 5/6 : FROM debian
+ ---> 1d2c3b4a5f6e
+Step 6/6 : COPY --from=0 /plan/testplan /
+ ---> Running in 6f5e4d3c2b1a
+The command '/bin/sh -c go build' returned a non-zero code: 1
+`
+
+	var buf bytes.Buffer
+	tracker := NewImageTracker(&buf)
+
+	// write the output in chunks that split lines.
+	for b := []byte(output); len(b) > 0; {
+		n := 7
+		if n > len(b) {
+			n = len(b)
+		}
+		if _, err := tracker.Write(b[:n]); err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+	}
+
+	if buf.String() != output {
+		t.Errorf("expected the output to be passed through, got %q", buf.String())
+	}
+
+	expected := []string{"9b0c7e6d5a42", "7a6b5c4d3e2f"}
+	if images := tracker.Images(); !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected images %v, got %v", expected, images)
+	}
+}
@@ -0,0 +1,26 @@
+package build
+
+import (
+	"os"
+
+	"github.com/otiai10/copy"
+)
+
+// MaterializeSymlink replaces dir with a copy of its target if it's a
+// symlink, as created by go-getter for local sources. It's a no-op otherwise.
+func MaterializeSymlink(dir string) error {
+	if fi, err := os.Lstat(dir); err != nil {
+		return err
+	} else if fi.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	// it's a symlink.
+	ref, err := os.Readlink(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dir); err != nil {
+		return err
+	}
+	return copy.Copy(ref, dir)
+}
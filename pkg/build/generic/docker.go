@@ -0,0 +1,210 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/build"
+	"github.com/ipfs/testground/pkg/docker"
+	"github.com/ipfs/testground/pkg/logging"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/archive"
+
+	"github.com/hashicorp/go-getter"
+)
+
+var (
+	_ api.Builder = &DockerGenericBuilder{}
+)
+
+const (
+	// BuildArgSelectors is the build arg carrying the comma-separated
+	// selectors of the build.
+	BuildArgSelectors = "TESTPLAN_SELECTORS"
+
+	// BuildArgDependencies is the build arg carrying the comma-separated
+	// dependency overrides of the build, as module=version or
+	// module=target@version pairs.
+	BuildArgDependencies = "TESTPLAN_DEPENDENCIES"
+)
+
+// DockerGenericBuilder builds a test plan into a container from a Dockerfile
+// supplied by the plan, regardless of the language the plan is written in.
+//
+// The resulting image must honour the runtime contract of test instances:
+// consume the TEST_* env vars, and emit events as JSON on stdout.
+type DockerGenericBuilder struct{}
+
+type DockerGenericBuilderConfig struct {
+	Enabled bool
+
+	// Dockerfile is the path to the Dockerfile, relative to the root of the
+	// test plan (default: "Dockerfile").
+	Dockerfile string `toml:"dockerfile" overridable:"yes"`
+
+	// BuildArgs are passed as build args to the docker build.
+	BuildArgs map[string]string `toml:"build_args" overridable:"yes"`
+
+	// PushRegistry, if true, will push the resulting image to a Docker
+	// registry.
+	PushRegistry bool `toml:"push_registry" overridable:"yes"`
+
+	// RegistryType is the type of registry this builder will push the generated
+	// Docker image to, if PushRegistry is true: "aws" (ECR), "dockerhub", or
+	// "generic" (the registry configured in the environment).
+	RegistryType string `toml:"registry_type" overridable:"yes"`
+}
+
+// Build builds the test plan with its own Dockerfile, using the plan directory
+// as the build context.
+//
+// Selectors and dependencies are passed to the build as the
+// TESTPLAN_SELECTORS and TESTPLAN_DEPENDENCIES build args respectively, so the
+// Dockerfile can forward them to the build tooling of the plan's language.
+func (b *DockerGenericBuilder) Build(ctx context.Context, in *api.BuildInput, output io.Writer) (*api.BuildOutput, error) {
+	cfg, ok := in.BuildConfig.(*DockerGenericBuilderConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected configuration type DockerGenericBuilderConfig, was: %T", in.BuildConfig)
+	}
+
+	cliopts := []client.Opt{
+		client.FromEnv,
+		client.WithAPIVersionNegotiation(),
+	}
+
+	var (
+		id       = in.BuildID
+		log      = logging.S().With("build_id", id)
+		cli, err = client.NewClientWithOpts(cliopts...)
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.PushRegistry {
+		if err := build.ValidateRegistryType(cfg.RegistryType); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create a temp dir, and copy the source into it.
+	tmp, err := ioutil.TempDir("", in.TestPlan.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed while creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	plandst := filepath.Join(tmp, "plan")
+
+	// Copy the plan's source; go-getter will create the dir.
+	if err := getter.Get(plandst, in.TestPlan.SourcePath, getter.WithContext(ctx)); err != nil {
+		return nil, err
+	}
+	if err := build.MaterializeSymlink(plandst); err != nil {
+		return nil, err
+	}
+
+	dockerfile := cfg.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	if _, err := os.Stat(filepath.Join(plandst, dockerfile)); err != nil {
+		return nil, fmt.Errorf("test plan has no usable Dockerfile at %s: %w", dockerfile, err)
+	}
+
+	// Local checkouts only make sense to builders that know how to wire them
+	// into the build of their language.
+	for _, dep := range in.Dependencies {
+		if dep.Path != "" {
+			return nil, fmt.Errorf("local path overrides are not supported by docker:generic; dependency: %s", dep)
+		}
+	}
+
+	args := buildArgs(cfg.BuildArgs, in.Selectors, in.Dependencies)
+
+	opts := types.ImageBuildOptions{
+		Tags:       []string{id},
+		Dockerfile: filepath.ToSlash(dockerfile),
+		BuildArgs:  args,
+	}
+
+	tar, err := archive.TarWithOptions(plandst, &archive.TarOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infow("building test plan with its own Dockerfile", "dockerfile", dockerfile)
+
+	// Build the image.
+	resp, err := cli.ImageBuild(ctx, tar, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Pipe the docker output to stdout.
+	if err := docker.PipeOutput(resp.Body, output); err != nil {
+		return nil, err
+	}
+
+	// We can't introspect the dependency set of an arbitrary build, so we
+	// report the overrides we were asked to apply.
+	out := &api.BuildOutput{
+		ArtifactPath: id,
+		Dependencies: in.Dependencies.AsMap(),
+	}
+
+	if cfg.PushRegistry {
+		err := build.PushImage(ctx, log, cli, cfg.RegistryType, in, out)
+		return out, err
+	}
+
+	return out, nil
+}
+
+func (*DockerGenericBuilder) ID() string {
+	return "docker:generic"
+}
+
+func (*DockerGenericBuilder) ConfigType() reflect.Type {
+	return reflect.TypeOf(DockerGenericBuilderConfig{})
+}
+
+// buildArgs assembles the build args of the docker build from the configured
+// ones, and the selectors and dependencies of the build.
+func buildArgs(cfgArgs map[string]string, selectors []string, deps api.Dependencies) map[string]*string {
+	args := make(map[string]*string, len(cfgArgs)+2)
+	for k, v := range cfgArgs {
+		v := v
+		args[k] = &v
+	}
+
+	if len(selectors) > 0 {
+		s := strings.Join(selectors, ",")
+		args[BuildArgSelectors] = &s
+	}
+
+	if len(deps) > 0 {
+		pairs := make([]string, 0, len(deps))
+		for _, dep := range deps {
+			pairs = append(pairs, dep.String())
+		}
+		sort.Strings(pairs)
+
+		s := strings.Join(pairs, ",")
+		args[BuildArgDependencies] = &s
+	}
+
+	return args
+}
@@ -0,0 +1,40 @@
+package generic
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+)
+
+func TestBuildArgs(t *testing.T) {
+	args := buildArgs(
+		map[string]string{"RUST_VERSION": "1.40"},
+		[]string{"foo", "bar"},
+		api.Dependencies{
+			{Module: "github.com/libp2p/rust-libp2p", Version: "v0.14.0"},
+			{Module: "github.com/ipfs/js-ipfs", Target: "github.com/me/js-ipfs", Version: "v0.40.0"},
+		},
+	)
+
+	expected := map[string]string{
+		"RUST_VERSION":          "1.40",
+		"TESTPLAN_SELECTORS":    "foo,bar",
+		"TESTPLAN_DEPENDENCIES": "github.com/ipfs/js-ipfs=github.com/me/js-ipfs@v0.40.0,github.com/libp2p/rust-libp2p=v0.14.0",
+	}
+
+	actual := make(map[string]string, len(args))
+	for k, v := range args {
+		actual[k] = *v
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected build args %v, got %v", expected, actual)
+	}
+}
+
+func TestBuildArgsEmpty(t *testing.T) {
+	if args := buildArgs(nil, nil, nil); len(args) != 0 {
+		t.Fatalf("expected no build args, got %v", args)
+	}
+}
@@ -2,11 +2,15 @@ package golang
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
+	"github.com/ipfs/testground/pkg/api"
+
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
@@ -14,6 +18,46 @@ import (
 	"go.uber.org/zap"
 )
 
+// replaceDirectives returns the `go mod edit` flags that apply the dependency
+// overrides of a build. localPath is called for overrides that point to a
+// local checkout, and returns the replacement path to use in go.mod.
+func replaceDirectives(deps api.Dependencies, localPath func(dep api.Dependency) (string, error)) ([]string, error) {
+	replaces := make([]string, 0, len(deps))
+	for _, dep := range deps {
+		var target string
+		switch {
+		case dep.Path != "":
+			if err := validateLocalDependency(dep); err != nil {
+				return nil, err
+			}
+			p, err := localPath(dep)
+			if err != nil {
+				return nil, fmt.Errorf("failed to use local checkout of %s: %w", dep.Module, err)
+			}
+			target = p
+		case dep.Target != "":
+			target = dep.Target + "@" + dep.Version
+		default:
+			target = dep.Module + "@" + dep.Version
+		}
+		replaces = append(replaces, fmt.Sprintf("-replace=%s=%s", dep.Module, target))
+	}
+	return replaces, nil
+}
+
+// validateLocalDependency checks that a local override points to the root of
+// a go module. The path must have been made absolute by the client, as the
+// daemon can't know what it was relative to.
+func validateLocalDependency(dep api.Dependency) error {
+	if !filepath.IsAbs(dep.Path) {
+		return fmt.Errorf("path of local override of %s must be absolute, was: %s", dep.Module, dep.Path)
+	}
+	if _, err := os.Stat(filepath.Join(dep.Path, "go.mod")); err != nil {
+		return fmt.Errorf("local override of %s is not a go module: %w", dep.Module, err)
+	}
+	return nil
+}
+
 func parseDependencies(raw string) map[string]string {
 	rawModules := strings.Split(raw, "\n")
 	modules := map[string]string{}
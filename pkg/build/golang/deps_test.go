@@ -2,8 +2,13 @@ package golang
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
 )
 
 var testParseDependencies = []struct {
@@ -49,3 +54,54 @@ func TestParseDependencies(t *testing.T) {
 		}
 	}
 }
+
+func TestReplaceDirectives(t *testing.T) {
+	local, err := ioutil.TempDir("", "local-dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	if err := ioutil.WriteFile(filepath.Join(local, "go.mod"), []byte("module example.com/module/c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deps := api.Dependencies{
+		{Module: "example.com/module/a", Version: "v1.2.0"},
+		{Module: "example.com/module/b", Target: "example.com/fork/b", Version: "v1.3.0"},
+		{Module: "example.com/module/c", Path: local},
+	}
+
+	replaces, err := replaceDirectives(deps, func(dep api.Dependency) (string, error) {
+		return "../deps/c", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"-replace=example.com/module/a=example.com/module/a@v1.2.0",
+		"-replace=example.com/module/b=example.com/fork/b@v1.3.0",
+		"-replace=example.com/module/c=../deps/c",
+	}
+	if !reflect.DeepEqual(replaces, expected) {
+		t.Fatalf("expected replaces %v, got %v", expected, replaces)
+	}
+}
+
+func TestReplaceDirectivesInvalidPath(t *testing.T) {
+	local, err := ioutil.TempDir("", "local-dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	noop := func(dep api.Dependency) (string, error) { return dep.Path, nil }
+
+	for _, path := range []string{"./relative", local} {
+		deps := api.Dependencies{{Module: "example.com/module/c", Path: path}}
+		if _, err := replaceDirectives(deps, noop); err == nil {
+			t.Errorf("expected an error for local override at %s", path)
+		}
+	}
+}
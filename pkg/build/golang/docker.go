@@ -2,8 +2,6 @@ package golang
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,7 +16,7 @@ import (
 	gobuild "go/build"
 
 	"github.com/ipfs/testground/pkg/api"
-	"github.com/ipfs/testground/pkg/aws"
+	"github.com/ipfs/testground/pkg/build"
 	"github.com/ipfs/testground/pkg/docker"
 	"github.com/ipfs/testground/pkg/logging"
 
@@ -55,7 +53,8 @@ type DockerGoBuilderConfig struct {
 	PushRegistry bool `toml:"push_registry" overridable:"yes"`
 
 	// RegistryType is the type of registry this builder will push the generated
-	// Docker image to, if PushRegistry is true.
+	// Docker image to, if PushRegistry is true: "aws" (ECR), "dockerhub", or
+	// "generic" (the registry configured in the environment).
 	RegistryType string `toml:"registry_type" overridable:"yes"`
 
 	// GoProxyMode specifies one of "on", "off", "custom".
@@ -70,6 +69,38 @@ type DockerGoBuilderConfig struct {
 
 	// GoProxyURL specifies the URL of the proxy when GoProxyMode = "custom".
 	GoProxyURL string `toml:"go_proxy_url" overridable:"yes"`
+
+	// Offline, if true, builds without network access. Modules are resolved
+	// from ModCache, and the build images must be present locally. GoProxyMode
+	// is ignored.
+	Offline bool `toml:"offline" overridable:"yes"`
+
+	// ModCache is the go module cache offline builds resolve modules from: a
+	// directory with the layout of $GOPATH/pkg/mod, or an archive of one. It
+	// defaults to the module cache of the host.
+	ModCache string `toml:"mod_cache" overridable:"yes"`
+
+	// GoIPFSArchive is the path to a go-ipfs dist tarball (as published on
+	// dist.ipfs.io) to install, instead of downloading GoIPFSVersion.
+	GoIPFSArchive string `toml:"go_ipfs_archive" overridable:"yes"`
+
+	// Race, if true, builds the test plan with the race detector enabled,
+	// which requires cgo.
+	Race bool `toml:"race" overridable:"yes"`
+
+	// Coverage, if true, instruments the test plan for coverage (go1.20+).
+	// Instances write their coverage data to their outputs, from which the
+	// `testground coverage` command merges it into a single profile.
+	Coverage bool `toml:"coverage" overridable:"yes"`
+
+	// CoverPkg is the comma-separated list of package patterns to instrument
+	// in coverage builds, e.g. "github.com/libp2p/go-libp2p-kad-dht/...". It
+	// defaults to the packages of the test plan.
+	CoverPkg string `toml:"cover_pkg" overridable:"yes"`
+
+	// BuildTimeout is the maximum duration of the build, as a Go duration
+	// (e.g. "15m"). It defaults to 5 minutes; "0" disables it.
+	BuildTimeout string `toml:"build_timeout" overridable:"yes"`
 }
 
 // TODO cache build outputs https://github.com/ipfs/testground/issues/36
@@ -91,29 +122,78 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 		cli, err = client.NewClientWithOpts(cliopts...)
 	)
 
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
+	if err != nil {
+		return nil, err
+	}
 
+	timeout, err := build.ParseTimeout(cfg.BuildTimeout, defaultBuildTimeout)
 	if err != nil {
 		return nil, err
 	}
 
-	// The testground-build network is used to connect build services (like the
-	// GOPROXY) to the build container.
-	b.proxyLk.Lock()
-	buildNetworkID, err := docker.EnsureBridgeNetwork(ctx, log, cli, "testground-build", false)
+	ctx, cancel := build.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// If the build fails, or is cancelled or times out, remove the images it
+	// left behind.
+	images := build.NewImageTracker(output)
+	out, err := b.build(ctx, log, cli, cfg, in, images)
 	if err != nil {
-		log.Errorf("error while creating a testground-build network: %s; forcing direct proxy mode", err)
-		cfg.GoProxyMode = "direct"
+		build.RemoveBuildImages(log, cli, id, images.Images())
+		return nil, build.TimeoutError(ctx, timeout, err)
+	}
+	return out, nil
+}
+
+func (b *DockerGoBuilder) build(ctx context.Context, log *zap.SugaredLogger, cli *client.Client, cfg *DockerGoBuilderConfig, in *api.BuildInput, output io.Writer) (*api.BuildOutput, error) {
+	id := in.BuildID
+
+	if cfg.PushRegistry {
+		if err := build.ValidateRegistryType(cfg.RegistryType); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Coverage {
+		goVersion := cfg.GoVersion
+		if goVersion == "" {
+			goVersion = defaultGoVersion
+		}
+		if err := checkCoverageGoVersion(goVersion); err != nil {
+			return nil, err
+		}
 	}
 
-	// Set up the go proxy wiring. This will start a goproxy container if
-	// necessary, attaching it to the testground-build network.
-	proxyURL, warn := setupGoProxy(ctx, log, cli, buildNetworkID, cfg)
-	if warn != nil {
-		log.Warnf("warning while setting up the go proxy: %s", warn)
+	var (
+		proxyURL    = offlineProxyURL
+		networkMode = "none"
+	)
+
+	if cfg.Offline {
+		if err := checkOfflineImages(ctx, cli, cfg); err != nil {
+			return nil, err
+		}
+	} else {
+		networkMode = "testground-build"
+
+		// The testground-build network is used to connect build services (like
+		// the GOPROXY) to the build container.
+		b.proxyLk.Lock()
+		buildNetworkID, err := docker.EnsureBridgeNetwork(ctx, log, cli, "testground-build", false)
+		if err != nil {
+			log.Errorf("error while creating a testground-build network: %s; forcing direct proxy mode", err)
+			cfg.GoProxyMode = "direct"
+		}
+
+		// Set up the go proxy wiring. This will start a goproxy container if
+		// necessary, attaching it to the testground-build network.
+		var warn error
+		proxyURL, warn = setupGoProxy(ctx, log, cli, buildNetworkID, cfg)
+		if warn != nil {
+			log.Warnf("warning while setting up the go proxy: %s", warn)
+		}
+		b.proxyLk.Unlock()
 	}
-	b.proxyLk.Unlock()
 
 	// Create a temp dir, and copy the source into it.
 	tmp, err := ioutil.TempDir("", in.TestPlan.Name)
@@ -129,6 +209,9 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 
 		plandst       = filepath.Join(tmp, "plan")
 		sdkdst        = filepath.Join(tmp, "sdk")
+		depsdst       = filepath.Join(tmp, "deps")
+		modcachedst   = filepath.Join(tmp, "modcache")
+		goipfsdst     = filepath.Join(tmp, "go-ipfs")
 		dockerfiledst = filepath.Join(tmp, "Dockerfile")
 	)
 
@@ -136,7 +219,7 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 	if err := getter.Get(plandst, plansrc, getter.WithContext(ctx)); err != nil {
 		return nil, err
 	}
-	if err := materializeSymlink(plandst); err != nil {
+	if err := build.MaterializeSymlink(plandst); err != nil {
 		return nil, err
 	}
 
@@ -153,7 +236,7 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 	if err := getter.Get(sdkdst, sdksrc, getter.WithContext(ctx)); err != nil {
 		return nil, err
 	}
-	if err := materializeSymlink(sdkdst); err != nil {
+	if err := build.MaterializeSymlink(sdkdst); err != nil {
 		return nil, err
 	}
 
@@ -176,11 +259,26 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 		}
 	}
 
-	// If we have version overrides, apply them.
-	var replaces []string
-	for mod, ver := range in.Dependencies {
-		// TODO(RK): allow to override target of replaces, so we can test against forks.
-		replaces = append(replaces, fmt.Sprintf("-replace=%s=%s@%s", mod, mod, ver))
+	// If we have dependency overrides, apply them. Local checkouts are copied
+	// into the build context, under deps/, which is always present as the
+	// Dockerfile copies it.
+	if err := os.Mkdir(depsdst, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create deps dir: %w", err)
+	}
+
+	replaces, err := replaceDirectives(in.Dependencies, func(dep api.Dependency) (string, error) {
+		name := strings.ReplaceAll(dep.Module, "/", "_")
+		dst := filepath.Join(depsdst, name)
+		if err := getter.Get(dst, dep.Path, getter.WithContext(ctx)); err != nil {
+			return "", err
+		}
+		if err := build.MaterializeSymlink(dst); err != nil {
+			return "", err
+		}
+		return "../deps/" + name, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Inject replace directives for the SDK modules.
@@ -199,6 +297,28 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 		return nil, fmt.Errorf("unable to add replace directives to go.mod; %w", err)
 	}
 
+	// The Dockerfile always copies the module cache and go-ipfs dirs, which
+	// are only populated when necessary.
+	for _, dir := range []string{modcachedst, goipfsdst} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create dir in build context: %w", err)
+		}
+	}
+
+	if cfg.GoIPFSArchive != "" {
+		if err := copyFile(filepath.Join(goipfsdst, "go-ipfs.tar.gz"), cfg.GoIPFSArchive); err != nil {
+			return nil, fmt.Errorf("failed to copy go-ipfs archive: %w", err)
+		}
+	}
+
+	if cfg.Offline {
+		// Seed the build context with the modules the build requires, failing
+		// up front if any of them is missing.
+		if err := seedOfflineModCache(ctx, log, cfg.ModCache, plandst, modcachedst); err != nil {
+			return nil, err
+		}
+	}
+
 	// initial go build args.
 	var args = map[string]*string{
 		"GO_VERSION":        &cfg.GoVersion,
@@ -207,16 +327,32 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 		"GO_PROXY":          &proxyURL,
 	}
 
+	if cfg.Offline {
+		off := "off"
+		args["GOSUMDB"] = &off
+	}
+
 	// set BUILD_TAGS arg if the user has provided selectors.
 	if len(in.Selectors) > 0 {
 		s := "-tags " + strings.Join(in.Selectors, ",")
 		args["BUILD_TAGS"] = &s
 	}
 
+	// set GO_BUILD_FLAGS (and CGO_ENABLED) if the build is instrumented.
+	if flags, cgo := instrumentFlags(cfg.Race, cfg.Coverage, cfg.CoverPkg); len(flags) > 0 {
+		s := strings.Join(flags, " ")
+		args["GO_BUILD_FLAGS"] = &s
+		if cgo {
+			one := "1"
+			args["CGO_ENABLED"] = &one
+		}
+	}
+
 	opts := types.ImageBuildOptions{
 		Tags:        []string{id, in.BuildID},
-		NetworkMode: "testground-build",
+		NetworkMode: networkMode,
 		BuildArgs:   args,
+		ForceRemove: true, // remove intermediate containers, even if the build fails.
 	}
 
 	tar, err := archive.TarWithOptions(tmp, &archive.TarOptions{})
@@ -247,17 +383,8 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 	}
 
 	if cfg.PushRegistry {
-		if cfg.RegistryType == "aws" {
-			err := pushToAWSRegistry(ctx, log, cli, in, out)
-			return out, err
-		}
-
-		if cfg.RegistryType == "dockerhub" {
-			err := pushToDockerHubRegistry(ctx, log, cli, in, out)
-			return out, err
-		}
-
-		return nil, fmt.Errorf("no registry type specified, or unrecognised value: %s", cfg.RegistryType)
+		err := build.PushImage(ctx, log, cli, cfg.RegistryType, in, out)
+		return out, err
 	}
 
 	return out, nil
@@ -271,89 +398,6 @@ func (*DockerGoBuilder) ConfigType() reflect.Type {
 	return reflect.TypeOf(DockerGoBuilderConfig{})
 }
 
-func pushToAWSRegistry(ctx context.Context, log *zap.SugaredLogger, client *client.Client, in *api.BuildInput, out *api.BuildOutput) error {
-	// Get a Docker registry authentication token from AWS ECR.
-	auth, err := aws.ECR.GetAuthToken(in.EnvConfig.AWS)
-	if err != nil {
-		return err
-	}
-
-	// AWS ECR repository name is testground-<region>-<plan_name>.
-	repo := fmt.Sprintf("testground-%s-%s", in.EnvConfig.AWS.Region, in.TestPlan.Name)
-
-	// Ensure the repo exists, or create it. Get the full URI to the repo, so we
-	// can tag images.
-	uri, err := aws.ECR.EnsureRepository(in.EnvConfig.AWS, repo)
-	if err != nil {
-		return err
-	}
-
-	// Tag the image under the AWS ECR repository.
-	tag := uri + ":" + in.BuildID
-	log.Infow("tagging image", "tag", tag)
-	if err = client.ImageTag(ctx, out.ArtifactPath, tag); err != nil {
-		return err
-	}
-
-	// TODO for some reason, this push is way slower than the equivalent via the
-	// docker CLI. Needs investigation.
-	log.Infow("pushing image", "tag", tag)
-	rc, err := client.ImagePush(ctx, tag, types.ImagePushOptions{
-		RegistryAuth: aws.ECR.EncodeAuthToken(auth),
-	})
-	if err != nil {
-		return err
-	}
-
-	// Pipe the docker output to stdout.
-	if err := docker.PipeOutput(rc, os.Stdout); err != nil {
-		return err
-	}
-
-	// replace the artifact path by the pushed image.
-	out.ArtifactPath = tag
-	return nil
-}
-
-func pushToDockerHubRegistry(ctx context.Context, log *zap.SugaredLogger, client *client.Client, in *api.BuildInput, out *api.BuildOutput) error {
-	uri := in.EnvConfig.DockerHub.Repo + "/testground"
-
-	tag := uri + ":" + in.BuildID
-	log.Infow("tagging image", "source", out.ArtifactPath, "repo", uri, "tag", tag)
-
-	if err := client.ImageTag(ctx, out.ArtifactPath, tag); err != nil {
-		return err
-	}
-
-	auth := types.AuthConfig{
-		Username: in.EnvConfig.DockerHub.Username,
-		Password: in.EnvConfig.DockerHub.AccessToken,
-	}
-	authBytes, err := json.Marshal(auth)
-	if err != nil {
-		return err
-	}
-	authBase64 := base64.URLEncoding.EncodeToString(authBytes)
-
-	rc, err := client.ImagePush(ctx, uri, types.ImagePushOptions{
-		RegistryAuth: authBase64,
-	})
-	if err != nil {
-		return err
-	}
-
-	log.Infow("pushed image", "source", out.ArtifactPath, "tag", tag, "repo", uri)
-
-	// Pipe the docker output to stdout.
-	if err := docker.PipeOutput(rc, os.Stdout); err != nil {
-		return err
-	}
-
-	// replace the artifact path by the pushed image.
-	out.ArtifactPath = tag
-	return nil
-}
-
 // setupGoProxy sets up a goproxy container, if and only if the build
 // configuration requires it.
 //
@@ -415,6 +459,69 @@ func setupGoProxy(ctx context.Context, log *zap.SugaredLogger, cli *client.Clien
 	return proxyURL, warn
 }
 
+// defaultBuildTimeout is the timeout of docker:go builds, unless overridden by
+// build_timeout.
+const defaultBuildTimeout = 5 * time.Minute
+
+// defaultGoVersion is the go version the Dockerfile builds with, unless
+// overridden by go_version.
+const defaultGoVersion = "1.13.4"
+
+// offlineProxyURL is the GOPROXY of offline builds, pointing to the module
+// cache seeded in the build context.
+const offlineProxyURL = "file:///modcache/cache/download"
+
+// checkOfflineImages verifies that the images an offline build is based on
+// are available locally, as they can't be pulled, and that it won't need to
+// download go-ipfs.
+func checkOfflineImages(ctx context.Context, cli *client.Client, cfg *DockerGoBuilderConfig) error {
+	if cfg.GoIPFSVersion != "" && cfg.GoIPFSArchive == "" {
+		return fmt.Errorf("offline build: go_ipfs_version is set, but no go_ipfs_archive was supplied to install it from")
+	}
+
+	goVersion := cfg.GoVersion
+	if goVersion == "" {
+		goVersion = defaultGoVersion
+	}
+
+	for _, img := range []string{"golang:" + goVersion + "-buster", "debian"} {
+		if _, _, err := cli.ImageInspectWithRaw(ctx, img); err != nil {
+			return fmt.Errorf("offline build: image %s is not available locally: %w", img, err)
+		}
+	}
+	return nil
+}
+
+// seedOfflineModCache populates dst with the modules required to build the
+// go module at plandir, resolving them from the module cache at src.
+func seedOfflineModCache(ctx context.Context, log *zap.SugaredLogger, src string, plandir string, dst string) error {
+	tmp, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		return fmt.Errorf("failed while creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	modcache, err := resolveModCache(ctx, src, tmp)
+	if err != nil {
+		return err
+	}
+
+	log.Infow("resolving modules from module cache for offline build", "mod_cache", modcache)
+
+	// Download the required modules into a scratch GOPATH, so that the build
+	// context only carries those.
+	gopath := filepath.Join(tmp, "gopath")
+	defer cleanModCache(gopath)
+
+	env := append(offlineEnv(modcache), "GOPATH="+gopath)
+	if err := checkOfflineModules(ctx, plandir, env); err != nil {
+		return err
+	}
+
+	// Only the download cache is needed to serve the modules as a GOPROXY.
+	return copy.Copy(filepath.Join(gopath, "pkg", "mod", "cache", "download"), filepath.Join(dst, "cache", "download"))
+}
+
 func validateSdkDir(dir string) error {
 	switch fi, err := os.Stat(dir); {
 	case err != nil:
@@ -433,20 +540,3 @@ func copyFile(dst, src string) error {
 	}
 	return ioutil.WriteFile(dst, in, 0644)
 }
-
-func materializeSymlink(dir string) error {
-	if fi, err := os.Lstat(dir); err != nil {
-		return err
-	} else if fi.Mode()&os.ModeSymlink == 0 {
-		return nil
-	}
-	// it's a symlink.
-	ref, err := os.Readlink(dir)
-	if err != nil {
-		return err
-	}
-	if err := os.Remove(dir); err != nil {
-		return err
-	}
-	return copy.Copy(ref, dir)
-}
@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/build"
 	"github.com/ipfs/testground/pkg/logging"
 
 	"github.com/hashicorp/go-getter"
@@ -30,6 +31,33 @@ type ExecGoBuilderConfig struct {
 	ModulePath string `toml:"module_path" overridable:"yes"`
 	ExecPkg    string `toml:"exec_pkg" overridable:"yes"`
 	FreshGomod bool   `toml:"fresh_gomod" overridable:"yes"`
+
+	// Offline, if true, builds without network access, resolving modules from
+	// ModCache.
+	Offline bool `toml:"offline" overridable:"yes"`
+
+	// ModCache is the go module cache offline builds resolve modules from: a
+	// directory with the layout of $GOPATH/pkg/mod, or an archive of one. It
+	// defaults to the module cache of the host.
+	ModCache string `toml:"mod_cache" overridable:"yes"`
+
+	// Race, if true, builds the test plan with the race detector enabled,
+	// which requires cgo.
+	Race bool `toml:"race" overridable:"yes"`
+
+	// Coverage, if true, instruments the test plan for coverage (go1.20+).
+	// Instances write their coverage data to their outputs, from which the
+	// `testground coverage` command merges it into a single profile.
+	Coverage bool `toml:"coverage" overridable:"yes"`
+
+	// CoverPkg is the comma-separated list of package patterns to instrument
+	// in coverage builds, e.g. "github.com/libp2p/go-libp2p-kad-dht/...". It
+	// defaults to the packages of the test plan.
+	CoverPkg string `toml:"cover_pkg" overridable:"yes"`
+
+	// BuildTimeout is the maximum duration of the build, as a Go duration
+	// (e.g. "15m"). By default, builds don't time out.
+	BuildTimeout string `toml:"build_timeout" overridable:"yes"`
 }
 
 // Build builds a testplan written in Go and outputs an executable.
@@ -45,6 +73,26 @@ func (b *ExecGoBuilder) Build(ctx context.Context, input *api.BuildInput, output
 		path = filepath.Join(input.Directories.WorkDir(), bin)
 	)
 
+	timeout, err := build.ParseTimeout(cfg.BuildTimeout, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cancelling the context kills the go build process.
+	ctx, cancel := build.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out, err := b.build(ctx, cfg, input, path)
+	if err != nil {
+		// Don't leave a partial executable behind.
+		_ = os.Remove(path)
+		return nil, build.TimeoutError(ctx, timeout, err)
+	}
+	return out, nil
+}
+
+func (b *ExecGoBuilder) build(ctx context.Context, cfg *ExecGoBuilderConfig, input *api.BuildInput, path string) (*api.BuildOutput, error) {
+
 	// Create a temp dir, and copy the source into it.
 	tmp, err := ioutil.TempDir("", input.TestPlan.Name)
 	if err != nil {
@@ -64,7 +112,7 @@ func (b *ExecGoBuilder) Build(ctx context.Context, input *api.BuildInput, output
 	if err := getter.Get(plandst, plansrc, getter.WithContext(ctx)); err != nil {
 		return nil, err
 	}
-	if err := materializeSymlink(plandst); err != nil {
+	if err := build.MaterializeSymlink(plandst); err != nil {
 		return nil, err
 	}
 
@@ -72,7 +120,7 @@ func (b *ExecGoBuilder) Build(ctx context.Context, input *api.BuildInput, output
 	if err := getter.Get(sdkdst, sdksrc, getter.WithContext(ctx)); err != nil {
 		return nil, err
 	}
-	if err := materializeSymlink(sdkdst); err != nil {
+	if err := build.MaterializeSymlink(sdkdst); err != nil {
 		return nil, err
 	}
 
@@ -95,11 +143,13 @@ func (b *ExecGoBuilder) Build(ctx context.Context, input *api.BuildInput, output
 		}
 	}
 
-	// If we have version overrides, apply them.
-	var replaces []string
-	for mod, ver := range input.Dependencies {
-		// TODO(RK): allow to override target of replaces, so we can test against forks.
-		replaces = append(replaces, fmt.Sprintf("-replace=%s=%s@%s", mod, mod, ver))
+	// If we have dependency overrides, apply them. We build on the host, so
+	// local checkouts are used in place.
+	replaces, err := replaceDirectives(input.Dependencies, func(dep api.Dependency) (string, error) {
+		return dep.Path, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Inject replace directives for the SDK modules.
@@ -118,6 +168,20 @@ func (b *ExecGoBuilder) Build(ctx context.Context, input *api.BuildInput, output
 		return nil, fmt.Errorf("unable to add replace directives to go.mod; %w", err)
 	}
 
+	// Offline builds resolve modules from the module cache only; check that
+	// all of them are there before building.
+	var env []string
+	if cfg.Offline {
+		modcache, err := resolveModCache(ctx, cfg.ModCache, tmp)
+		if err != nil {
+			return nil, err
+		}
+		env = offlineEnv(modcache)
+		if err := checkOfflineModules(ctx, plandst, env); err != nil {
+			return nil, err
+		}
+	}
+
 	// Calculate the arguments to go build.
 	// go build -o <output_path> [-tags <comma-separated tags>] <exec_pkg>
 	var args = []string{"build", "-o", path}
@@ -125,13 +189,23 @@ func (b *ExecGoBuilder) Build(ctx context.Context, input *api.BuildInput, output
 		args = append(args, "-tags")
 		args = append(args, strings.Join(input.Selectors, ","))
 	}
+	flags, cgo := instrumentFlags(cfg.Race, cfg.Coverage, cfg.CoverPkg)
+	args = append(args, flags...)
 	args = append(args, cfg.ExecPkg)
 
+	if cgo {
+		if env == nil {
+			env = os.Environ()
+		}
+		env = append(env, "CGO_ENABLED=1")
+	}
+
 	fmt.Printf("%v\n", args)
 
 	// Execute the build.
 	cmd = exec.CommandContext(ctx, "go", args...)
 	cmd.Dir = plandst
+	cmd.Env = env
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		logging.S().Errorf("go build failed: %s", string(out))
@@ -140,6 +214,7 @@ func (b *ExecGoBuilder) Build(ctx context.Context, input *api.BuildInput, output
 
 	cmd = exec.CommandContext(ctx, "go", "list", "-m", "all")
 	cmd.Dir = plandst
+	cmd.Env = env
 	out, err = cmd.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("unable to list module dependencies; %w", err)
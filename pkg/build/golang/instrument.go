@@ -0,0 +1,40 @@
+package golang
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// instrumentFlags returns the go build flags that enable the race detector
+// and/or coverage instrumentation, and whether the build requires cgo as a
+// result. coverpkg is a comma-separated list of the package patterns to
+// instrument for coverage; if empty, only the packages of the test plan are
+// instrumented.
+func instrumentFlags(race, coverage bool, coverpkg string) (flags []string, cgo bool) {
+	if race {
+		flags = append(flags, "-race")
+		cgo = true
+	}
+	if coverage {
+		flags = append(flags, "-cover")
+		if coverpkg != "" {
+			flags = append(flags, "-coverpkg="+coverpkg)
+		}
+	}
+	return flags, cgo
+}
+
+// checkCoverageGoVersion returns an error if the supplied go version can't
+// build instrumented binaries for coverage, which requires go1.20+.
+func checkCoverageGoVersion(version string) error {
+	parts := strings.SplitN(strings.TrimPrefix(version, "go"), ".", 3)
+	if len(parts) >= 2 {
+		major, errMaj := strconv.Atoi(parts[0])
+		minor, errMin := strconv.Atoi(parts[1])
+		if errMaj == nil && errMin == nil && (major > 1 || minor >= 20) {
+			return nil
+		}
+	}
+	return fmt.Errorf("coverage builds require go 1.20 or later; go_version was: %q", version)
+}
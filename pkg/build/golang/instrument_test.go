@@ -0,0 +1,41 @@
+package golang
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInstrumentFlags(t *testing.T) {
+	tests := []struct {
+		race, coverage bool
+		coverpkg       string
+		flags          []string
+		cgo            bool
+	}{
+		{flags: nil},
+		{race: true, flags: []string{"-race"}, cgo: true},
+		{coverage: true, flags: []string{"-cover"}},
+		{coverage: true, coverpkg: "example.com/a/...,example.com/b", flags: []string{"-cover", "-coverpkg=example.com/a/...,example.com/b"}},
+		{race: true, coverage: true, flags: []string{"-race", "-cover"}, cgo: true},
+	}
+
+	for i, test := range tests {
+		flags, cgo := instrumentFlags(test.race, test.coverage, test.coverpkg)
+		if !reflect.DeepEqual(flags, test.flags) || cgo != test.cgo {
+			t.Errorf("test %d: expected flags %v (cgo: %t), got %v (cgo: %t)", i, test.flags, test.cgo, flags, cgo)
+		}
+	}
+}
+
+func TestCheckCoverageGoVersion(t *testing.T) {
+	for _, v := range []string{"1.20", "1.21.5", "go1.22", "2.0"} {
+		if err := checkCoverageGoVersion(v); err != nil {
+			t.Errorf("expected go version %s to support coverage, got: %s", v, err)
+		}
+	}
+	for _, v := range []string{"", "1.13.4", "1.19", "latest"} {
+		if err := checkCoverageGoVersion(v); err == nil {
+			t.Errorf("expected go version %s not to support coverage", v)
+		}
+	}
+}
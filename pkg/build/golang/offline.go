@@ -0,0 +1,108 @@
+package golang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	gobuild "go/build"
+
+	"github.com/hashicorp/go-getter"
+)
+
+// resolveModCache returns the go module cache that offline builds resolve
+// modules from. src can be a module cache directory (i.e. with the layout of
+// $GOPATH/pkg/mod), or an archive of one, which is extracted under tmp. If src
+// is empty, the module cache of the host is used.
+func resolveModCache(ctx context.Context, src string, tmp string) (string, error) {
+	if src == "" {
+		src = filepath.Join(gobuild.Default.GOPATH, "pkg", "mod")
+	}
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to access module cache: %w", err)
+	}
+
+	dir := src
+	if !fi.IsDir() {
+		// it's an archive; go-getter decompresses it based on its extension.
+		dir = filepath.Join(tmp, "modcache-src")
+		if err := getter.Get(dir, src, getter.WithContext(ctx)); err != nil {
+			return "", fmt.Errorf("failed to extract module cache archive: %w", err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "cache", "download")); err != nil {
+		return "", fmt.Errorf("%s is not a go module cache; expected a cache/download directory: %w", src, err)
+	}
+	return dir, nil
+}
+
+// offlineEnv returns the environment of go commands that must resolve modules
+// exclusively from the module cache at modcache, and never touch the network.
+func offlineEnv(modcache string) []string {
+	return append(os.Environ(),
+		"GOPROXY="+modProxyURL(modcache),
+		"GOSUMDB=off",
+	)
+}
+
+// modProxyURL returns the URL of the module cache at modcache, to be used as
+// a GOPROXY.
+func modProxyURL(modcache string) string {
+	return "file://" + filepath.ToSlash(filepath.Join(modcache, "cache", "download"))
+}
+
+// checkOfflineModules downloads all modules required to build the go module
+// at dir using the supplied environment, which must not allow network access
+// (see offlineEnv). It reports all modules missing from the module cache in
+// a single error, so that they can be seeded in one go.
+func checkOfflineModules(ctx context.Context, dir string, env []string) error {
+	cmd := exec.CommandContext(ctx, "go", "mod", "download", "-json")
+	cmd.Dir = dir
+	cmd.Env = env
+
+	out, err := cmd.Output()
+
+	var missing []string
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var mod struct {
+			Path    string
+			Version string
+			Error   string
+		}
+		if err := dec.Decode(&mod); err != nil {
+			break
+		}
+		if mod.Error != "" {
+			missing = append(missing, mod.Path+"@"+mod.Version)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("offline build: %d modules missing from the module cache: %s", len(missing), strings.Join(missing, ", "))
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("offline build: failed to resolve modules from the module cache: %s", bytes.TrimSpace(exitErr.Stderr))
+	}
+	return err
+}
+
+// cleanModCache removes a module cache created under gopath. Extracted
+// modules are read-only, so os.RemoveAll on its own would fail.
+func cleanModCache(gopath string) {
+	cmd := exec.Command("go", "clean", "-modcache")
+	cmd.Env = append(os.Environ(), "GOPATH="+gopath)
+	_ = cmd.Run()
+	_ = os.RemoveAll(gopath)
+}
@@ -0,0 +1,63 @@
+package golang
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveModCacheInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "modcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := resolveModCache(context.Background(), dir, dir); err == nil {
+		t.Fatal("expected an error for a dir that isn't a module cache")
+	}
+}
+
+func TestCheckOfflineModulesMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		moddir   = filepath.Join(dir, "mod")
+		modcache = filepath.Join(dir, "modcache")
+		gopath   = filepath.Join(dir, "gopath")
+	)
+	defer cleanModCache(gopath)
+
+	if err := os.MkdirAll(filepath.Join(modcache, "cache", "download"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(moddir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	gomod := "module example.com/plan\n\ngo 1.13\n\nrequire example.com/missing v1.0.0\n"
+	if err := ioutil.WriteFile(filepath.Join(moddir, "go.mod"), []byte(gomod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mc, err := resolveModCache(context.Background(), modcache, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := append(offlineEnv(mc), "GOPATH="+gopath, "GOFLAGS=-mod=mod")
+	err = checkOfflineModules(context.Background(), moddir, env)
+	if err == nil {
+		t.Fatal("expected an error for a missing module")
+	}
+	if !strings.Contains(err.Error(), "example.com/missing") {
+		t.Fatalf("expected the missing module to be reported, got: %s", err)
+	}
+}
@@ -38,15 +38,19 @@ func TestBuildSelector(t *testing.T) {
 
 	buildFn := func(builder string, selectors []string, assertion func(err error, msgsAndArgs ...interface{})) func(t *testing.T) {
 		return func(t *testing.T) {
+			// go_proxy_mode is only understood by docker:go.
+			var buildcfg map[string]interface{}
+			if builder == "docker:go" {
+				buildcfg = map[string]interface{}{"go_proxy_mode": "direct"}
+			}
+
 			comp := &api.Composition{
 				Global: api.Global{
 					Builder:        builder,
 					Plan:           "placebo",
 					Case:           "ok",
 					TotalInstances: 1,
-					BuildConfig: map[string]interface{}{
-						"go_proxy_mode": "direct",
-					},
+					BuildConfig:    buildcfg,
 				},
 				Groups: []api.Group{
 					api.Group{
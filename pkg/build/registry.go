@@ -0,0 +1,275 @@
+package build
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/aws"
+	"github.com/ipfs/testground/pkg/config"
+	"github.com/ipfs/testground/pkg/docker"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"go.uber.org/zap"
+)
+
+// PushImage pushes the image referenced by the artifact path of the build
+// output to a registry of the given type ("aws", "dockerhub" or "generic");
+// see ValidateRegistryType. On success, the artifact path is replaced by the
+// pushed image.
+func PushImage(ctx context.Context, log *zap.SugaredLogger, client *client.Client, registryType string, in *api.BuildInput, out *api.BuildOutput) error {
+	switch registryType {
+	case "aws":
+		return PushToAWSRegistry(ctx, log, client, in, out)
+	case "dockerhub":
+		return PushToDockerHubRegistry(ctx, log, client, in, out)
+	case "generic":
+		return PushToGenericRegistry(ctx, log, client, in, out)
+	default:
+		return ValidateRegistryType(registryType)
+	}
+}
+
+// ValidateRegistryType returns an error if the registry type is not supported
+// by PushImage. Builders call it before building, so that a misconfigured
+// push doesn't waste a build.
+func ValidateRegistryType(registryType string) error {
+	switch registryType {
+	case "aws", "dockerhub", "generic":
+		return nil
+	default:
+		return fmt.Errorf("no registry type specified, or unrecognised value: %q; supported values: aws, dockerhub, generic", registryType)
+	}
+}
+
+// PushToAWSRegistry pushes the image to an AWS ECR repository named after the
+// test plan, creating it if necessary.
+func PushToAWSRegistry(ctx context.Context, log *zap.SugaredLogger, client *client.Client, in *api.BuildInput, out *api.BuildOutput) error {
+	// Get a Docker registry authentication token from AWS ECR.
+	auth, err := aws.ECR.GetAuthToken(in.EnvConfig.AWS)
+	if err != nil {
+		return err
+	}
+
+	// AWS ECR repository name is testground-<region>-<plan_name>.
+	repo := fmt.Sprintf("testground-%s-%s", in.EnvConfig.AWS.Region, in.TestPlan.Name)
+
+	// Ensure the repo exists, or create it. Get the full URI to the repo, so we
+	// can tag images.
+	uri, err := aws.ECR.EnsureRepository(in.EnvConfig.AWS, repo)
+	if err != nil {
+		return err
+	}
+
+	// Tag the image under the AWS ECR repository.
+	tag := uri + ":" + in.BuildID
+	log.Infow("tagging image", "tag", tag)
+	if err = client.ImageTag(ctx, out.ArtifactPath, tag); err != nil {
+		return err
+	}
+
+	// TODO for some reason, this push is way slower than the equivalent via the
+	// docker CLI. Needs investigation.
+	log.Infow("pushing image", "tag", tag)
+	rc, err := client.ImagePush(ctx, tag, types.ImagePushOptions{
+		RegistryAuth: aws.ECR.EncodeAuthToken(auth),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Pipe the docker output to stdout.
+	if err := docker.PipeOutput(rc, os.Stdout); err != nil {
+		return err
+	}
+
+	// replace the artifact path by the pushed image.
+	out.ArtifactPath = tag
+	return nil
+}
+
+// PushToDockerHubRegistry pushes the image to the configured DockerHub
+// repository.
+func PushToDockerHubRegistry(ctx context.Context, log *zap.SugaredLogger, client *client.Client, in *api.BuildInput, out *api.BuildOutput) error {
+	uri := in.EnvConfig.DockerHub.Repo + "/testground"
+
+	tag := uri + ":" + in.BuildID
+	log.Infow("tagging image", "source", out.ArtifactPath, "repo", uri, "tag", tag)
+
+	if err := client.ImageTag(ctx, out.ArtifactPath, tag); err != nil {
+		return err
+	}
+
+	authBase64, err := docker.EncodeRegistryAuth(types.AuthConfig{
+		Username: in.EnvConfig.DockerHub.Username,
+		Password: in.EnvConfig.DockerHub.AccessToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	rc, err := client.ImagePush(ctx, uri, types.ImagePushOptions{
+		RegistryAuth: authBase64,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infow("pushed image", "source", out.ArtifactPath, "tag", tag, "repo", uri)
+
+	// Pipe the docker output to stdout.
+	if err := docker.PipeOutput(rc, os.Stdout); err != nil {
+		return err
+	}
+
+	// replace the artifact path by the pushed image.
+	out.ArtifactPath = tag
+	return nil
+}
+
+// RegistryNaming holds the values the repository and tag templates of the
+// generic registry are rendered with.
+type RegistryNaming struct {
+	// Plan is the name of the test plan.
+	Plan string
+	// BuildID is the ID of the build.
+	BuildID string
+}
+
+// GenericRegistryImage returns the reference the image of a build is pushed to
+// in the generic registry, i.e. <host>/<repository>:<tag>.
+func GenericRegistryImage(cfg config.RegistryConfig, naming RegistryNaming) (string, error) {
+	if cfg.Host == "" {
+		return "", fmt.Errorf("no generic registry host configured; set host in the registry section of .env.toml")
+	}
+
+	repo, tag := cfg.Repository, cfg.Tag
+	if repo == "" {
+		repo = "testground/{{.Plan}}"
+	}
+	if tag == "" {
+		tag = "{{.BuildID}}"
+	}
+
+	render := func(name, text string) (string, error) {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("invalid registry %s template: %w", name, err)
+		}
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, naming); err != nil {
+			return "", fmt.Errorf("failed to render registry %s template: %w", name, err)
+		}
+		return buf.String(), nil
+	}
+
+	repo, err := render("repository", repo)
+	if err != nil {
+		return "", err
+	}
+	tag, err = render("tag", tag)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Host + "/" + repo + ":" + tag, nil
+}
+
+// CheckRegistry checks that the generic registry is reachable and serves the
+// registry API, so that pushes to a misconfigured registry fail early and
+// clearly. In insecure mode, plain HTTP and unverified certificates are
+// accepted.
+func CheckRegistry(ctx context.Context, cfg config.RegistryConfig) error {
+	if cfg.Host == "" {
+		return fmt.Errorf("no generic registry host configured; set host in the registry section of .env.toml")
+	}
+
+	var (
+		tr      = &http.Transport{}
+		schemes = []string{"https"}
+	)
+	if cfg.Insecure {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		schemes = append(schemes, "http")
+	}
+
+	cl := &http.Client{Transport: tr, Timeout: 10 * time.Second}
+	defer tr.CloseIdleConnections()
+
+	var errs []string
+	for _, scheme := range schemes {
+		url := scheme + "://" + cfg.Host + "/v2/"
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := cl.Do(req)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		_ = resp.Body.Close()
+
+		// 401 means the registry is there, but requires authentication, which
+		// the docker daemon takes care of.
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusUnauthorized {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: unexpected status: %s", url, resp.Status))
+	}
+	return fmt.Errorf("registry %s is unreachable: %s", cfg.Host, strings.Join(errs, "; "))
+}
+
+// PushToGenericRegistry pushes the image to the generic registry configured
+// in the environment, under the repository and tag rendered from its
+// templates.
+func PushToGenericRegistry(ctx context.Context, log *zap.SugaredLogger, client *client.Client, in *api.BuildInput, out *api.BuildOutput) error {
+	cfg := in.EnvConfig.Registry
+
+	tag, err := GenericRegistryImage(cfg, RegistryNaming{Plan: in.TestPlan.Name, BuildID: in.BuildID})
+	if err != nil {
+		return err
+	}
+
+	if err := CheckRegistry(ctx, cfg); err != nil {
+		return err
+	}
+
+	log.Infow("tagging image", "source", out.ArtifactPath, "tag", tag)
+	if err := client.ImageTag(ctx, out.ArtifactPath, tag); err != nil {
+		return err
+	}
+
+	auth, err := docker.EncodeRegistryAuth(types.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		ServerAddress: cfg.Host,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infow("pushing image", "tag", tag)
+	rc, err := client.ImagePush(ctx, tag, types.ImagePushOptions{
+		RegistryAuth: auth,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Pipe the docker output to stdout.
+	if err := docker.PipeOutput(rc, os.Stdout); err != nil {
+		return err
+	}
+
+	// replace the artifact path by the pushed image.
+	out.ArtifactPath = tag
+	return nil
+}
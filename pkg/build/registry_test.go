@@ -0,0 +1,85 @@
+package build
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/config"
+)
+
+func TestGenericRegistryImage(t *testing.T) {
+	naming := RegistryNaming{Plan: "dht", BuildID: "a1b2c3"}
+
+	tests := []struct {
+		cfg      config.RegistryConfig
+		expected string
+		err      bool
+	}{
+		{
+			cfg:      config.RegistryConfig{Host: "localhost:5000"},
+			expected: "localhost:5000/testground/dht:a1b2c3",
+		},
+		{
+			cfg:      config.RegistryConfig{Host: "registry.example.com", Repository: "perf/{{.Plan}}-plans", Tag: "{{.Plan}}-{{.BuildID}}"},
+			expected: "registry.example.com/perf/dht-plans:dht-a1b2c3",
+		},
+		{cfg: config.RegistryConfig{}, err: true},
+		{cfg: config.RegistryConfig{Host: "localhost:5000", Tag: "{{.Unknown}}"}, err: true},
+		{cfg: config.RegistryConfig{Host: "localhost:5000", Repository: "{{.Plan"}, err: true},
+	}
+
+	for i, test := range tests {
+		img, err := GenericRegistryImage(test.cfg, naming)
+		if (err != nil) != test.err {
+			t.Errorf("test %d: expected error: %t, got: %v", i, test.err, err)
+			continue
+		}
+		if img != test.expected {
+			t.Errorf("test %d: expected image %s, got %s", i, test.expected, img)
+		}
+	}
+}
+
+func TestCheckRegistry(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer registry.Close()
+
+	other := httptest.NewServer(http.NotFoundHandler())
+	defer other.Close()
+
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	if err := CheckRegistry(context.Background(), config.RegistryConfig{Host: host, Insecure: true}); err != nil {
+		t.Errorf("expected plain HTTP registry to be reachable in insecure mode, got: %s", err)
+	}
+	if err := CheckRegistry(context.Background(), config.RegistryConfig{Host: host}); err == nil {
+		t.Errorf("expected plain HTTP registry to be rejected in secure mode")
+	}
+
+	host = strings.TrimPrefix(other.URL, "http://")
+	if err := CheckRegistry(context.Background(), config.RegistryConfig{Host: host, Insecure: true}); err == nil {
+		t.Errorf("expected a server that doesn't serve the registry API to be rejected")
+	}
+}
+
+func TestValidateRegistryType(t *testing.T) {
+	for _, typ := range []string{"aws", "dockerhub", "generic"} {
+		if err := ValidateRegistryType(typ); err != nil {
+			t.Errorf("expected registry type %s to be valid, got: %s", typ, err)
+		}
+	}
+	for _, typ := range []string{"", "gcr"} {
+		if err := ValidateRegistryType(typ); err == nil {
+			t.Errorf("expected registry type %q to be invalid", typ)
+		}
+	}
+}
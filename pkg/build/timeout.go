@@ -0,0 +1,42 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ParseTimeout parses a build timeout expressed as a Go duration, e.g. "15m".
+// If s is empty, def is returned. A zero timeout means no timeout.
+func ParseTimeout(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid build timeout %q: %w", s, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid build timeout %q: must not be negative", s)
+	}
+	return d, nil
+}
+
+// WithTimeout returns a context that expires after timeout, or the supplied
+// context itself if timeout is zero.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// TimeoutError annotates err to state that the build timed out, if that's
+// the reason why ctx is done.
+func TimeoutError(ctx context.Context, timeout time.Duration, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("build timed out after %s: %w", timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected time.Duration
+		err      bool
+	}{
+		{in: "", expected: 5 * time.Minute},
+		{in: "30m", expected: 30 * time.Minute},
+		{in: "1h30m", expected: 90 * time.Minute},
+		{in: "0", expected: 0},
+		{in: "-1m", err: true},
+		{in: "ten minutes", err: true},
+	}
+
+	for _, test := range tests {
+		d, err := ParseTimeout(test.in, 5*time.Minute)
+		if (err != nil) != test.err {
+			t.Errorf("%q: expected error: %t, got: %v", test.in, test.err, err)
+			continue
+		}
+		if d != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.in, test.expected, d)
+		}
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	err := TimeoutError(ctx, time.Nanosecond, errors.New("boom"))
+	if !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected a timeout error, got: %s", err)
+	}
+
+	ctx, cancel = WithTimeout(context.Background(), 0)
+	cancel()
+
+	err = TimeoutError(ctx, 0, errors.New("boom"))
+	if err.Error() != "boom" {
+		t.Fatalf("expected cancellation not to be reported as a timeout, got: %s", err)
+	}
+}
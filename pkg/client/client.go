@@ -8,7 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
 
 	"github.com/ipfs/testground/pkg/logging"
 	"github.com/ipfs/testground/pkg/tgwriter"
@@ -127,6 +129,46 @@ func (c *Client) Healthcheck(ctx context.Context, r *HealthcheckRequest) (io.Rea
 	return c.request(ctx, "POST", "/healthcheck", bytes.NewReader(body.Bytes()))
 }
 
+// ExportArtifact sends an `artifact export` request to the daemon.
+//
+// The Body in the response is the archive of the artifact; it's up to the
+// caller to close it.
+func (c *Client) ExportArtifact(ctx context.Context, r *ArtifactExportRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", "http://"+c.endpoint+"/artifact/export", &body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	// the archive is sent raw, once it is complete, so errors are signalled
+	// by the status.
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("artifact export failed: %s", bytes.TrimSpace(msg))
+	}
+	return resp.Body, nil
+}
+
+// ImportArtifact sends an `artifact import` request to the daemon, uploading
+// the supplied archive.
+//
+// The Body in the response implement an io.ReadCloser and it's up to the caller
+// to close it.
+func (c *Client) ImportArtifact(ctx context.Context, archive io.Reader) (io.ReadCloser, error) {
+	return c.request(ctx, "POST", "/artifact/import", archive)
+}
+
 func parseGeneric(r io.ReadCloser, fnProgress, fnResult func(interface{}) error) error {
 	var msg tgwriter.Msg
 
@@ -156,13 +198,21 @@ func parseGeneric(r io.ReadCloser, fnProgress, fnResult func(interface{}) error)
 }
 
 func printProgress(progress interface{}) error {
-	m, err := base64.StdEncoding.DecodeString(progress.(string))
-	if err != nil {
+	return printProgressTo(os.Stdout)(progress)
+}
+
+// printProgressTo returns a progress function that prints to the supplied
+// writer.
+func printProgressTo(w io.Writer) func(interface{}) error {
+	return func(progress interface{}) error {
+		m, err := base64.StdEncoding.DecodeString(progress.(string))
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprint(w, string(m))
 		return err
 	}
-
-	fmt.Print(string(m))
-	return nil
 }
 
 // ParseRunResponse parses a response from a `run` call
@@ -224,13 +274,30 @@ func ParseTerminateRequest(r io.ReadCloser) error {
 	)
 }
 
-// ParseHealthcheckResponse parses a response from a 'healthcheck' call
-func ParseHealthcheckResponse(r io.ReadCloser) (HealthcheckResponse, error) {
+// ParseHealthcheckResponse parses a response from a 'healthcheck' call.
+// Progress is written to the supplied writer.
+func ParseHealthcheckResponse(r io.ReadCloser, progress io.Writer) (HealthcheckResponse, error) {
 	var resp HealthcheckResponse
 
 	err := parseGeneric(
 		r,
-		printProgress,
+		printProgressTo(progress),
+		func(result interface{}) error {
+			return mapstructure.Decode(result, &resp)
+		},
+	)
+
+	return resp, err
+}
+
+// ParseHealthcheckAllResponse parses a response from a 'healthcheck' call
+// with All set. Progress is written to the supplied writer.
+func ParseHealthcheckAllResponse(r io.ReadCloser, progress io.Writer) (HealthcheckAllResponse, error) {
+	var resp HealthcheckAllResponse
+
+	err := parseGeneric(
+		r,
+		printProgressTo(progress),
 		func(result interface{}) error {
 			return mapstructure.Decode(result, &resp)
 		},
@@ -239,6 +306,26 @@ func ParseHealthcheckResponse(r io.ReadCloser) (HealthcheckResponse, error) {
 	return resp, err
 }
 
+// ParseImportArtifactResponse parses a response from an 'artifact import'
+// call.
+func ParseImportArtifactResponse(r io.ReadCloser) (ArtifactImportResponse, error) {
+	var resp ArtifactImportResponse
+	err := parseGeneric(
+		r,
+		printProgress,
+		func(result interface{}) error {
+			// the metadata carries json tags and timestamps, which
+			// mapstructure doesn't handle; go through json instead.
+			b, err := json.Marshal(result)
+			if err != nil {
+				return err
+			}
+			return json.Unmarshal(b, &resp)
+		},
+	)
+	return resp, err
+}
+
 func (c *Client) request(ctx context.Context, method string, path string, body io.Reader) (io.ReadCloser, error) {
 	req, err := http.NewRequest(method, "http://"+c.endpoint+path, body)
 	req = req.WithContext(ctx)
@@ -34,6 +34,23 @@ type TerminateRequest struct {
 type HealthcheckRequest struct {
 	Runner string `json:"runner"`
 	Fix    bool   `json:"fix"`
+	// All checks every runner and builder that supports healthchecks,
+	// ignoring Runner.
+	All bool `json:"all"`
 }
 
 type HealthcheckResponse = api.HealthcheckReport
+
+// HealthcheckAllResponse is the response to a healthcheck request with All
+// set. Reports are keyed by runner or builder ID.
+type HealthcheckAllResponse = map[string]*api.HealthcheckReport
+
+// ArtifactExportRequest is the request struct for the `artifact export`
+// function.
+type ArtifactExportRequest struct {
+	Artifact string `json:"artifact"`
+}
+
+// ArtifactImportResponse is the response struct for the `artifact import`
+// function.
+type ArtifactImportResponse = api.ArtifactMetadata
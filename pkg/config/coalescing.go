@@ -4,16 +4,25 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
 
+// EnabledKey is the key that enables a build or run strategy. It's accepted by
+// all strategies, whether their configuration type has a field for it or not.
+const EnabledKey = "enabled"
+
 type CoalescedConfig []map[string]interface{}
 
 func (c CoalescedConfig) Append(in map[string]interface{}) CoalescedConfig {
 	return append(c, in)
 }
 
+// CoalesceIntoType coalesces all configurations, later ones taking precedence,
+// and deserialises the result into a new value of the supplied struct type. It
+// fails if any key doesn't map to a field of the type.
 func (c CoalescedConfig) CoalesceIntoType(typ reflect.Type) (interface{}, error) {
 	all := make(map[string]interface{})
 
@@ -34,6 +43,116 @@ func (c CoalescedConfig) CoalesceIntoType(typ reflect.Type) (interface{}, error)
 	}
 
 	v := reflect.New(typ).Interface()
-	_, err := toml.DecodeReader(buf, v)
-	return v, err
+	md, err := toml.DecodeReader(buf, v)
+	if err != nil {
+		return nil, err
+	}
+
+	if unknown := unknownKeys(md); len(unknown) > 0 {
+		keys := ConfigKeys(typ)
+		msgs := make([]string, 0, len(unknown))
+		for _, k := range unknown {
+			msgs = append(msgs, fmt.Sprintf("unknown configuration key %q%s", k, DidYouMean(k, keys)))
+		}
+		return nil, fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+
+	return v, nil
+}
+
+// unknownKeys returns the keys that couldn't be decoded, sorted. Keys nested
+// under an unknown key aren't reported on their own.
+func unknownKeys(md toml.MetaData) []string {
+	var (
+		top = make(map[string]bool)
+		out []string
+	)
+	for _, k := range md.Undecoded() {
+		if len(k) == 1 {
+			top[k[0]] = true
+		}
+	}
+	for _, k := range md.Undecoded() {
+		if len(k) == 1 && k[0] == EnabledKey {
+			continue
+		}
+		if len(k) > 1 && top[k[0]] {
+			continue
+		}
+		out = append(out, k.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ConfigKeys returns the keys that map to the fields of a configuration struct
+// type: their toml key, or their lowercased name if they have none.
+func ConfigKeys(typ reflect.Type) (out []string) {
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported.
+		}
+		if t, ok := f.Tag.Lookup("toml"); ok {
+			if name := strings.Split(t, ",")[0]; name != "-" && name != "" {
+				out = append(out, name)
+				continue
+			}
+		}
+		out = append(out, strings.ToLower(f.Name))
+	}
+	return out
+}
+
+// DidYouMean returns a suggestion for a mistyped key, in the form
+// `; did you mean "x"?`, picking the closest candidate. It returns an empty
+// string if no candidate is close enough.
+func DidYouMean(key string, candidates []string) string {
+	var (
+		best     string
+		bestDist = len(key)/3 + 2 // tolerate roughly one typo every three chars.
+	)
+	for _, c := range candidates {
+		if d := levenshtein(key, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf("; did you mean %q?", best)
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
 }
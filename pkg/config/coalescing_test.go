@@ -0,0 +1,67 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testConfig struct {
+	KeepContainers bool   `toml:"keep_containers"`
+	LogLevel       string `toml:"log_level"`
+	Retries        int
+}
+
+func TestCoalesceIntoType(t *testing.T) {
+	var cfg CoalescedConfig
+	cfg = cfg.Append(map[string]interface{}{"enabled": true, "log_level": "info", "retries": 1})
+	cfg = cfg.Append(map[string]interface{}{"keep_containers": true, "log_level": "debug"})
+
+	v, err := cfg.CoalesceIntoType(reflect.TypeOf(testConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &testConfig{KeepContainers: true, LogLevel: "debug", Retries: 1}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, v)
+	}
+}
+
+func TestCoalesceIntoTypeUnknownKeys(t *testing.T) {
+	var cfg CoalescedConfig
+	cfg = cfg.Append(map[string]interface{}{"keep_contaners": true, "frobnicate": "yes"})
+
+	_, err := cfg.CoalesceIntoType(reflect.TypeOf(testConfig{}))
+	if err == nil {
+		t.Fatal("expected unknown keys to be rejected")
+	}
+
+	for _, s := range []string{
+		`unknown configuration key "frobnicate"`,
+		`unknown configuration key "keep_contaners"; did you mean "keep_containers"?`,
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected error to contain %q, got: %s", s, err)
+		}
+	}
+
+	if strings.Contains(err.Error(), `"frobnicate"; did you mean`) {
+		t.Errorf("expected no suggestion for an unrelated key, got: %s", err)
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	candidates := []string{"go_version", "go_ipfs_version", "exec_pkg"}
+
+	for key, expected := range map[string]string{
+		"go_verison":  `; did you mean "go_version"?`,
+		"exec_pk":     `; did you mean "exec_pkg"?`,
+		"gover":       "",
+		"module_path": "",
+	} {
+		if s := DidYouMean(key, candidates); s != expected {
+			t.Errorf("DidYouMean(%q): expected %q, got %q", key, expected, s)
+		}
+	}
+}
@@ -29,6 +29,8 @@ var (
 type EnvConfig struct {
 	AWS             AWSConfig            `toml:"aws"`
 	DockerHub       DockerHubConfig      `toml:"dockerhub"`
+	Registry        RegistryConfig       `toml:"registry"`
+	Outputs         OutputsConfig        `toml:"outputs"`
 	BuildStrategies map[string]ConfigMap `toml:"build_strategies"`
 	RunStrategies   map[string]ConfigMap `toml:"run_strategies"`
 	Daemon          DaemonConfig         `toml:"daemon"`
@@ -57,6 +59,50 @@ type DockerHubConfig struct {
 	AccessToken string `toml:"access_token"`
 }
 
+// RegistryConfig configures the generic OCI registry that builders push
+// images to when their registry_type is "generic", e.g. a self-hosted
+// registry, or a local registry:2 container.
+type RegistryConfig struct {
+	// Host is the host of the registry, with an optional port, e.g.
+	// "localhost:5000".
+	Host     string `toml:"host"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// Insecure, if true, allows talking to the registry over plain HTTP, or
+	// HTTPS without verifying its certificate. The docker daemons pushing and
+	// pulling images must list the host in their insecure-registries too.
+	Insecure bool `toml:"insecure"`
+	// Repository is the template of the name of the repository images are
+	// pushed to (default: "testground/{{.Plan}}").
+	Repository string `toml:"repository"`
+	// Tag is the template of the tag of pushed images (default:
+	// "{{.BuildID}}").
+	Tag string `toml:"tag"`
+}
+
+// OutputsConfig selects and configures the storage backend for run outputs.
+type OutputsConfig struct {
+	// Driver is the storage driver; one of "fs" (default) or "s3".
+	Driver string `toml:"driver"`
+	// Dir is the root directory of the "fs" driver. If empty, every runner
+	// stores outputs in its own directory under the work directory.
+	Dir string `toml:"dir"`
+	// S3 configures the "s3" driver.
+	S3 S3Config `toml:"s3"`
+}
+
+// S3Config configures access to an S3-compatible bucket. Credentials default
+// to those in the aws table if not set.
+type S3Config struct {
+	Bucket          string `toml:"bucket"`
+	Region          string `toml:"region"`
+	Endpoint        string `toml:"endpoint"`
+	PathStyle       bool   `toml:"path_style"`
+	DisableSSL      bool   `toml:"disable_ssl"`
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+}
+
 type DaemonConfig struct {
 	Listen string `toml:"listen"`
 }
@@ -0,0 +1,91 @@
+// Package coverage merges the coverage data written by the instances of a run
+// of a test plan built in coverage mode.
+//
+// Instances of coverage builds write their coverage data files (covmeta.* and
+// covcounters.*, see `go help covdata`) to their outputs dir, so they end up
+// in the outputs of the run, with the following layout:
+//
+//	<run_id>/<group_id>/<instance_number>/covmeta.<hash>
+//
+// Merging them requires go1.20+ to be available on the PATH.
+package coverage
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IsDataFile returns whether the file name is that of a coverage data file,
+// i.e. a meta-data file or a counters file.
+func IsDataFile(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(base, "covmeta.") || strings.HasPrefix(base, "covcounters.")
+}
+
+// ExtractZip extracts the coverage data files contained in an outputs archive
+// into dst, preserving the directory of each instance, and returns the
+// directories holding coverage data, sorted.
+func ExtractZip(zr *zip.Reader, dst string) ([]string, error) {
+	dirs := make(map[string]struct{})
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !IsDataFile(f.Name) {
+			continue
+		}
+
+		p := filepath.Join(dst, filepath.FromSlash(path.Clean("/"+f.Name)))
+		if err := extractFile(f, p); err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", f.Name, err)
+		}
+		dirs[filepath.Dir(p)] = struct{}{}
+	}
+
+	res := make([]string, 0, len(dirs))
+	for d := range dirs {
+		res = append(res, d)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func extractFile(f *zip.File, p string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, rc)
+	return err
+}
+
+// Merge merges the coverage data found in dirs into a single profile written
+// to out, in the text format consumed by `go tool cover`.
+func Merge(ctx context.Context, dirs []string, out string) error {
+	if len(dirs) == 0 {
+		return fmt.Errorf("no coverage data to merge")
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "tool", "covdata", "textfmt", "-i="+strings.Join(dirs, ","), "-o="+out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to merge coverage data: %w; output: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package coverage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const program = `package main
+
+import "os"
+
+func main() {
+	if len(os.Args) > 1 {
+		println("with args")
+		return
+	}
+	println("without args")
+}
+`
+
+// writeZip builds an outputs archive with the supplied files.
+func writeZip(t *testing.T, files map[string][]byte) *zip.Reader {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestExtractZip(t *testing.T) {
+	dst, err := ioutil.TempDir("", "coverage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	zr := writeZip(t, map[string][]byte{
+		"run/group/0/covmeta.abc":            []byte("meta"),
+		"run/group/0/covcounters.abc.1.2":    []byte("counters"),
+		"run/group/0/run.out":                []byte("{}"),
+		"run/group/1/covmeta.abc":            []byte("meta"),
+		"run/other/0/run.out":                []byte("{}"),
+		"../../escape/covcounters.abc.1.2":   []byte("counters"),
+		"run/group/1/metrics/covmeta.nested": []byte("meta"),
+	})
+
+	dirs, err := ExtractZip(zr, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(dst, "escape"),
+		filepath.Join(dst, "run", "group", "0"),
+		filepath.Join(dst, "run", "group", "1"),
+		filepath.Join(dst, "run", "group", "1", "metrics"),
+	}
+	if strings.Join(dirs, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected dirs %v, got %v", expected, dirs)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "run", "group", "0", "run.out")); !os.IsNotExist(err) {
+		t.Fatalf("expected non-coverage files not to be extracted")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coverage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Build an instrumented binary, and run it as two instances.
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/cov\n\ngo 1.20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bin := filepath.Join(dir, "cov")
+	cmd := exec.Command("go", "build", "-cover", "-o", bin, ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("unable to build an instrumented binary (go1.20+ required): %s", out)
+	}
+
+	var dirs []string
+	for i, args := range [][]string{nil, {"arg"}} {
+		d := filepath.Join(dir, "instances", strconv.Itoa(i))
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(bin, args...)
+		cmd.Env = append(os.Environ(), "GOCOVERDIR="+d)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("instance failed: %s: %s", err, out)
+		}
+		dirs = append(dirs, d)
+	}
+
+	out := filepath.Join(dir, "coverage.out")
+	if err := Merge(context.Background(), dirs, out); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both branches were exercised by one instance or the other, so no block
+	// must have a zero count.
+	lines := strings.Split(strings.TrimSpace(string(profile)), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "mode:") {
+		t.Fatalf("unexpected profile:\n%s", profile)
+	}
+	for _, l := range lines[1:] {
+		if strings.HasSuffix(l, " 0") {
+			t.Errorf("expected all blocks to be covered, got: %s", l)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+func (srv *Daemon) artifactExportHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("ruid", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "artifact export")
+		defer log.Debugw("request handled", "command", "artifact export")
+
+		var req client.ArtifactExportRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			log.Errorw("artifact export json decode", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Spool the archive to a temp file, and only send it once it's
+		// complete: errors can't be reported once the archive is streaming.
+		f, err := ioutil.TempFile("", "artifact-export")
+		if err != nil {
+			log.Errorw("artifact export error", "err", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		if err := engine.DoExportArtifact(r.Context(), req.Artifact, f); err != nil {
+			log.Errorw("artifact export error", "err", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		fi, err := f.Stat()
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			log.Errorw("artifact export error", "err", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		if _, err := io.Copy(w, f); err != nil {
+			log.Warnw("failed to send artifact archive", "err", err.Error())
+		}
+	}
+}
+
+func (srv *Daemon) artifactImportHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("ruid", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "artifact import")
+		defer log.Debugw("request handled", "command", "artifact import")
+
+		tgw := tgwriter.New(w, log)
+
+		meta, err := engine.DoImportArtifact(r.Context(), r.Body, tgw)
+		if err != nil {
+			tgw.WriteError("artifact import error", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult(meta)
+	}
+}
@@ -51,6 +51,8 @@ func New(listenAddr string) (srv *Daemon, err error) {
 	r.HandleFunc("/outputs", srv.outputsHandler(engine)).Methods("POST")
 	r.HandleFunc("/terminate", srv.terminateHandler(engine)).Methods("POST")
 	r.HandleFunc("/healthcheck", srv.healthcheckHandler(engine)).Methods("POST")
+	r.HandleFunc("/artifact/export", srv.artifactExportHandler(engine)).Methods("POST")
+	r.HandleFunc("/artifact/import", srv.artifactImportHandler(engine)).Methods("POST")
 
 	srv.doneCh = make(chan struct{})
 	srv.server = &http.Server{
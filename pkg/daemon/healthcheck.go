@@ -27,6 +27,17 @@ func (srv *Daemon) healthcheckHandler(engine api.Engine) func(w http.ResponseWri
 			return
 		}
 
+		if req.All {
+			out, err := engine.DoHealthcheckAll(r.Context(), req.Fix, tgw)
+			if err != nil {
+				tgw.WriteError("healthcheck error", "err", err.Error())
+				return
+			}
+
+			tgw.WriteResult(out)
+			return
+		}
+
 		out, err := engine.DoHealthcheck(r.Context(), req.Runner, req.Fix, tgw)
 		if err != nil {
 			tgw.WriteError("healthcheck error", "err", err.Error())
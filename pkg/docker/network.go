@@ -2,6 +2,7 @@ package docker
 
 import (
 	"context"
+	"net"
 
 	"github.com/docker/docker/api/types/filters"
 	"go.uber.org/zap"
@@ -11,11 +12,14 @@ import (
 	"github.com/docker/docker/client"
 )
 
+// NewBridgeNetwork creates a bridge network. IPv6 is enabled on the network if
+// any of the IPAM configs has an IPv6 subnet.
 func NewBridgeNetwork(ctx context.Context, cli *client.Client, name string, internal bool, labels map[string]string, config ...network.IPAMConfig) (id string, err error) {
 	res, err := cli.NetworkCreate(ctx, name, types.NetworkCreate{
 		Driver:     "bridge",
 		Attachable: true,
 		Internal:   internal,
+		EnableIPv6: hasIPv6(config),
 		Labels:     labels,
 		IPAM: &network.IPAM{
 			Config: config,
@@ -27,6 +31,15 @@ func NewBridgeNetwork(ctx context.Context, cli *client.Client, name string, inte
 	return res.ID, nil
 }
 
+func hasIPv6(config []network.IPAMConfig) bool {
+	for _, c := range config {
+		if ip, _, err := net.ParseCIDR(c.Subnet); err == nil && ip.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
 func CheckBridgeNetwork(ctx context.Context, log *zap.SugaredLogger, cli *client.Client, name string) ([]types.NetworkResource, error) {
 	opts := types.NetworkListOptions{
 		Filters: filters.NewArgs(
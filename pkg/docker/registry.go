@@ -0,0 +1,18 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/docker/docker/api/types"
+)
+
+// EncodeRegistryAuth encodes registry credentials in the format the docker
+// API expects them, e.g. to push images, or to create services that pull them.
+func EncodeRegistryAuth(auth types.AuthConfig) (string, error) {
+	b, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/artifact"
+	"github.com/ipfs/testground/pkg/build/generic"
 	"github.com/ipfs/testground/pkg/build/golang"
 	"github.com/ipfs/testground/pkg/config"
 	"github.com/ipfs/testground/pkg/logging"
@@ -23,6 +27,7 @@ import (
 var AllBuilders = []api.Builder{
 	&golang.DockerGoBuilder{},
 	&golang.ExecGoBuilder{},
+	&generic.DockerGenericBuilder{},
 }
 
 // AllRunners enumerates all runners known to the system.
@@ -191,6 +196,7 @@ func (e *Engine) DoBuild(ctx context.Context, comp *api.Composition, output io.W
 	//
 	// Precedence (highest to lowest):
 	//
+	//  0. Group build_config (applied per group below).
 	//  1. CLI --run-param, --build-param flags.
 	//  2. .env.toml.
 	//  3. Test plan definition.
@@ -209,13 +215,25 @@ func (e *Engine) DoBuild(ctx context.Context, comp *api.Composition, output io.W
 	cfg = cfg.Append(e.envcfg.BuildStrategies[builder])
 
 	// 1. Get overrides from the CLI.
+	if err := api.ValidateOverrides(bm.ConfigType(), comp.Global.BuildConfig); err != nil {
+		return nil, fmt.Errorf("invalid build_config: %w", err)
+	}
 	cfg = cfg.Append(comp.Global.BuildConfig)
 
-	// Coalesce all configurations and deserialise into the config type
-	// mandated by the builder.
-	obj, err := cfg.CoalesceIntoType(bm.ConfigType())
-	if err != nil {
-		return nil, fmt.Errorf("error while coalescing configuration values: %w", err)
+	// 0. Coalesce the overrides of each group over the global configuration,
+	// and deserialise into the config type mandated by the builder.
+	objs := make([]interface{}, len(comp.Groups))
+	for i, grp := range comp.Groups {
+		if err := api.ValidateOverrides(bm.ConfigType(), grp.Build.BuildConfig); err != nil {
+			return nil, fmt.Errorf("group %s: invalid build_config: %w", grp.ID, err)
+		}
+
+		gcfg := append(config.CoalescedConfig{}, cfg...).Append(grp.Build.BuildConfig)
+		obj, err := gcfg.CoalesceIntoType(bm.ConfigType())
+		if err != nil {
+			return nil, fmt.Errorf("error while coalescing configuration values of group %s: %w", grp.ID, err)
+		}
+		objs[i] = obj
 	}
 
 	var (
@@ -231,12 +249,41 @@ func (e *Engine) DoBuild(ctx context.Context, comp *api.Composition, output io.W
 	ctx, cancel = context.WithCancel(ctx)
 	defer cancel()
 
-	// Trigger a build for each group, and wait until all of them are done.
+	// Groups with identical build inputs produce identical artifacts, so we
+	// build each unique combination once, and fan the output out to all the
+	// groups that share it.
+	var (
+		keys  []string
+		byKey = make(map[string][]int) // build key => indices of groups.
+	)
 	for i, grp := range comp.Groups {
-		i, grp := i, grp // captures
+		// the effective build configuration of the group is part of its
+		// build inputs.
+		c, err := json.Marshal(objs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		k := grp.Build.BuildKey() + "|" + string(c)
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], i)
+	}
+
+	// Trigger a build for each unique set of build inputs, and wait until all
+	// of them are done.
+	for _, k := range keys {
+		idxs := byKey[k]
+		grp, obj := comp.Groups[idxs[0]], objs[idxs[0]]
+
+		ids := make([]string, 0, len(idxs))
+		for _, i := range idxs {
+			ids = append(ids, comp.Groups[i].ID)
+		}
 
 		errgrp.Go(func() (err error) {
-			logging.S().Infow("performing build for group", "plan", testplan, "group", grp.ID, "builder", builder)
+			logging.S().Infow("performing build for groups", "plan", testplan, "groups", ids, "builder", builder)
 
 			in := &api.BuildInput{
 				BuildID:      uuid.New().String()[24:],
@@ -245,18 +292,33 @@ func (e *Engine) DoBuild(ctx context.Context, comp *api.Composition, output io.W
 				Directories:  e.envcfg,
 				TestPlan:     plan,
 				Selectors:    grp.Build.Selectors,
-				Dependencies: grp.Build.Dependencies.AsMap(),
+				Dependencies: grp.Build.Dependencies,
 			}
 
 			res, err := bm.Build(ctx, in, output)
 			if err != nil {
-				logging.S().Infow("build failed", "plan", testplan, "group", grp.ID, "builder", builder, "error", err)
+				logging.S().Infow("build failed", "plan", testplan, "groups", ids, "builder", builder, "error", err)
 				return err
 			}
 
 			res.BuilderID = bm.ID()
-			ress[i] = res
-			logging.S().Infow("build succeeded", "plan", testplan, "group", grp.ID, "builder", builder, "artifact", res.ArtifactPath)
+			for _, i := range idxs {
+				out := *res
+				ress[i] = &out
+			}
+
+			// Record the artifact, so that it can be exported later.
+			meta := &api.ArtifactMetadata{
+				BuilderID:    res.BuilderID,
+				Plan:         testplan,
+				ArtifactPath: res.ArtifactPath,
+				Dependencies: res.Dependencies,
+				CreatedAt:    time.Now(),
+			}
+			if err := artifact.Record(e.envcfg.WorkDir(), meta); err != nil {
+				logging.S().Warnw("failed to record artifact metadata", "artifact", res.ArtifactPath, "error", err)
+			}
+			logging.S().Infow("build succeeded", "plan", testplan, "groups", ids, "builder", builder, "artifact", res.ArtifactPath)
 			return nil
 		})
 	}
@@ -368,6 +430,9 @@ func (e *Engine) DoRun(ctx context.Context, comp *api.Composition, output io.Wri
 	cfg = cfg.Append(e.envcfg.RunStrategies[runner])
 
 	// 1. Get overrides from the CLI.
+	if err := api.ValidateOverrides(run.ConfigType(), comp.Global.RunConfig); err != nil {
+		return nil, fmt.Errorf("invalid run_config: %w", err)
+	}
 	cfg = cfg.Append(comp.Global.RunConfig)
 
 	// Coalesce all configurations and deserialise into the config type
@@ -414,6 +479,7 @@ func (e *Engine) DoRun(ctx context.Context, comp *api.Composition, output io.Wri
 			Instances:    int(grp.CalculatedInstanceCount()),
 			ArtifactPath: grp.Run.Artifact,
 			Parameters:   params,
+			NAT:          grp.Run.NAT,
 		}
 
 		in.Groups = append(in.Groups, g)
@@ -484,6 +550,27 @@ func (e *Engine) DoTerminate(ctx context.Context, runner string, w io.Writer) er
 	return err
 }
 
+// DoExportArtifact writes an archive of the supplied artifact to w. Only
+// artifacts built or imported by this engine can be exported.
+func (e *Engine) DoExportArtifact(ctx context.Context, art string, w io.Writer) error {
+	meta, err := artifact.Lookup(e.envcfg.WorkDir(), art)
+	if err != nil {
+		return err
+	}
+	return artifact.Export(ctx, meta, w)
+}
+
+// DoImportArtifact imports an artifact from an archive produced by
+// DoExportArtifact, and returns its metadata.
+func (e *Engine) DoImportArtifact(ctx context.Context, r io.Reader, w io.Writer) (*api.ArtifactMetadata, error) {
+	meta, err := artifact.Import(ctx, r, e.envcfg.WorkDir(), w)
+	if err != nil {
+		return nil, err
+	}
+	logging.S().Infow("imported artifact", "plan", meta.Plan, "builder", meta.BuilderID, "artifact", meta.ArtifactPath)
+	return meta, nil
+}
+
 func (e *Engine) DoHealthcheck(ctx context.Context, runner string, fix bool, w io.Writer) (*api.HealthcheckReport, error) {
 	run, ok := e.runners[runner]
 	if !ok {
@@ -503,6 +590,51 @@ func (e *Engine) DoHealthcheck(ctx context.Context, runner string, fix bool, w i
 	return hc.Healthcheck(fix, e, w)
 }
 
+// DoHealthcheckAll runs the healthchecks of every registered runner and
+// builder that supports them. Reports are keyed by runner or builder ID; a
+// checker that errors is reported with a failed check.
+func (e *Engine) DoHealthcheckAll(ctx context.Context, fix bool, w io.Writer) (map[string]*api.HealthcheckReport, error) {
+	checkers := make(map[string]api.Healthchecker)
+	for id, b := range e.ListBuilders() {
+		if hc, ok := b.(api.Healthchecker); ok {
+			checkers[id] = hc
+		}
+	}
+	for id, r := range e.ListRunners() {
+		if hc, ok := r.(api.Healthchecker); ok {
+			checkers[id] = hc
+		}
+	}
+
+	ids := make([]string, 0, len(checkers))
+	for id := range checkers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	reports := make(map[string]*api.HealthcheckReport, len(ids))
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write([]byte("checking " + id + "\n")); err != nil {
+			return nil, err
+		}
+
+		rep, err := checkers[id].Healthcheck(fix, e, w)
+		if err != nil {
+			// don't let one checker abort the others; report it as failed.
+			msg := fmt.Sprintf("healthcheck errored: %s", err)
+			rep = &api.HealthcheckReport{
+				Checks: []api.HealthcheckItem{{Name: "healthcheck", Status: api.HealthcheckStatusFailed, Message: msg}},
+			}
+		}
+		reports[id] = rep
+	}
+	return reports, nil
+}
+
 // EnvConfig returns the EnvConfig for this Engine.
 func (e *Engine) EnvConfig() config.EnvConfig {
 	return *e.envcfg
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
+)
+
+// checkedRunner is a runner whose healthcheck returns the configured report
+// or error.
+type checkedRunner struct {
+	api.Runner
+	id     string
+	report *api.HealthcheckReport
+	err    error
+}
+
+func (r *checkedRunner) ID() string { return r.id }
+
+func (r *checkedRunner) Healthcheck(bool, api.Engine, io.Writer) (*api.HealthcheckReport, error) {
+	return r.report, r.err
+}
+
+func TestHealthcheckAllContinuesAfterError(t *testing.T) {
+	ok := &api.HealthcheckReport{
+		Checks: []api.HealthcheckItem{{Name: "check", Status: api.HealthcheckStatusOK}},
+	}
+
+	e := &Engine{
+		builders: map[string]api.Builder{},
+		runners: map[string]api.Runner{
+			"a": &checkedRunner{id: "a", err: errors.New("boom")},
+			"b": &checkedRunner{id: "b", report: ok},
+		},
+		envcfg: &config.EnvConfig{},
+		ctx:    context.Background(),
+	}
+
+	reports, err := e.DoHealthcheckAll(context.Background(), false, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a := reports["a"]; a == nil || a.ChecksSucceeded() || !strings.Contains(a.Checks[0].Message, "boom") {
+		t.Errorf("expected a failed report for the erroring checker, got %+v", a)
+	}
+	if reports["b"] != ok {
+		t.Errorf("expected the report of the second checker, got %+v", reports["b"])
+	}
+
+	// no fix was requested, so there are no fixes to report.
+	b, err := json.Marshal(reports["b"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "fixes") {
+		t.Errorf("expected no fixes in the report, got %s", b)
+	}
+}
@@ -0,0 +1,11 @@
+// Package outputs provides pluggable storage backends for the outputs produced
+// by test plan instances during a run.
+//
+// Outputs are addressed by slash-separated keys with the following layout:
+//
+//   <run_id>/<group_id>/<instance_number>/<file>
+//
+// Two drivers are available: "fs", which stores outputs in a local directory,
+// and "s3", which stores outputs in an S3-compatible bucket (e.g. AWS S3 or a
+// MinIO deployment).
+package outputs
@@ -0,0 +1,90 @@
+package outputs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ Store = (*FSStore)(nil)
+
+// FSStore is an outputs Store backed by a directory in the local filesystem.
+// Keys map to paths relative to the root directory.
+type FSStore struct {
+	root string
+}
+
+// NewFSStore returns a filesystem store rooted at the specified directory,
+// creating it if necessary.
+func NewFSStore(root string) (*FSStore, error) {
+	if err := os.MkdirAll(root, 0777); err != nil {
+		return nil, err
+	}
+	return &FSStore{root: root}, nil
+}
+
+// Root returns the root directory of this store.
+func (s *FSStore) Root() string {
+	return s.root
+}
+
+func (s *FSStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+func (s *FSStore) Put(ctx context.Context, key string, r io.Reader) error {
+	p := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		return err
+	}
+
+	file, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, r)
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *FSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *FSStore) Walk(ctx context.Context, prefix string, fn func(key string) error) error {
+	dir := s.path(prefix)
+
+	if fi, err := os.Stat(dir); os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return ErrNotFound
+	}
+
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+
+		return fn(strings.TrimPrefix(filepath.ToSlash(rel), "/"))
+	})
+}
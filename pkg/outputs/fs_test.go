@@ -0,0 +1,106 @@
+package outputs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFSStoreZip(t *testing.T) {
+	ctx := context.Background()
+
+	tmp, err := ioutil.TempDir("", "outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	store, err := NewFSStore(filepath.Join(tmp, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stage some outputs in a local directory, and upload them.
+	staged := filepath.Join(tmp, "staged")
+	files := map[string]string{
+		"single/0/run.out": "instance 0",
+		"single/1/run.out": "instance 1",
+	}
+	for name, content := range files {
+		p := filepath.Join(staged, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := PutDir(ctx, store, "abcd", staged); err != nil {
+		t.Fatal(err)
+	}
+
+	// another run that must not be included in the archive.
+	if err := store.Put(ctx, "efgh/single/0/run.out", strings.NewReader("other")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Zip(ctx, store, "abcd", buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(zr.File) != len(files) {
+		t.Fatalf("expected %d entries in archive, got %d", len(files), len(zr.File))
+	}
+
+	for _, f := range zr.File {
+		want, ok := files[strings.TrimPrefix(f.Name, "abcd/")]
+		if !ok {
+			t.Fatalf("unexpected entry in archive: %s", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("entry %s: expected %q, got %q", f.Name, want, got)
+		}
+	}
+}
+
+func TestFSStoreNotFound(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	store, err := NewFSStore(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Zip(context.Background(), store, "missing", buf); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got %d bytes", buf.Len())
+	}
+}
@@ -0,0 +1,154 @@
+package outputs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ipfs/testground/pkg/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+var _ Store = (*S3Store)(nil)
+
+// defaultS3Region is used when no region is configured. S3-compatible stores
+// like MinIO accept any region, but the AWS SDK requires one.
+const defaultS3Region = "us-east-1"
+
+// S3Store is an outputs Store backed by an S3-compatible bucket.
+type S3Store struct {
+	bucket string
+	sess   *session.Session
+	svc    *s3.S3
+}
+
+// NewS3Store returns an S3 store for the configured bucket. Credentials are
+// taken from the S3 configuration if present, falling back to the AWS
+// configuration, and finally to the default AWS credentials chain.
+func NewS3Store(cfg config.S3Config, awscfg config.AWSConfig) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("no outputs bucket configured")
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = awscfg.Region
+	}
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	c := aws.NewConfig().
+		WithRegion(region).
+		WithS3ForcePathStyle(cfg.PathStyle).
+		WithDisableSSL(cfg.DisableSSL)
+
+	if cfg.Endpoint != "" {
+		c = c.WithEndpoint(cfg.Endpoint)
+	}
+
+	switch {
+	case cfg.AccessKeyID != "" && cfg.SecretAccessKey != "":
+		c = c.WithCredentials(credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""))
+	case awscfg.AccessKeyID != "" && awscfg.SecretAccessKey != "":
+		c = c.WithCredentials(credentials.NewStaticCredentials(awscfg.AccessKeyID, awscfg.SecretAccessKey, ""))
+	}
+
+	sess, err := session.NewSession(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish an S3 session: %w", err)
+	}
+
+	return &S3Store{
+		bucket: cfg.Bucket,
+		sess:   sess,
+		svc:    s3.New(sess),
+	}, nil
+}
+
+// Bucket returns the bucket backing this store.
+func (s *S3Store) Bucket() string {
+	return s.bucket
+}
+
+// CheckAccess verifies that the bucket exists and that we are allowed to
+// access it.
+func (s *S3Store) CheckAccess(ctx context.Context) error {
+	_, err := s.svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to access bucket %s: %w", s.bucket, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := s3manager.NewUploader(s.sess).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to bucket %s: %w", key, s.bucket, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s from bucket %s: %w", key, s.bucket, err)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Walk(ctx context.Context, prefix string, fn func(key string) error) error {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var (
+		found bool
+		ferr  error
+	)
+
+	query := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	err := s.svc.ListObjectsV2PagesWithContext(ctx, query, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, item := range page.Contents {
+			// skip directory placeholders created by s3fs and similar tools.
+			if strings.HasSuffix(*item.Key, "/") {
+				continue
+			}
+			found = true
+			if ferr = fn(*item.Key); ferr != nil {
+				return false
+			}
+		}
+		return true
+	})
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("unable to list items in bucket %s: %w", s.bucket, err)
+	case ferr != nil:
+		return ferr
+	case !found:
+		return ErrNotFound
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package outputs
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/ipfs/testground/pkg/config"
+)
+
+// ErrNotFound is returned when no outputs exist under the requested prefix.
+var ErrNotFound = errors.New("outputs not found")
+
+// Store is the interface to be implemented by all outputs storage backends.
+type Store interface {
+	// Put stores the contents of the reader under the specified key,
+	// overwriting any previous value.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Get returns a reader over the contents stored under the specified key.
+	// It's up to the caller to close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Walk calls fn for every key under the specified prefix, in lexical
+	// order. It returns ErrNotFound if no keys exist under the prefix.
+	Walk(ctx context.Context, prefix string, fn func(key string) error) error
+}
+
+// NewStore returns the Store selected by the supplied configuration.
+//
+// defaultDir is the root directory used by the fs driver when no directory has
+// been configured explicitly; usually, the outputs directory of the runner.
+func NewStore(cfg config.OutputsConfig, aws config.AWSConfig, defaultDir string) (Store, error) {
+	switch cfg.Driver {
+	case "", "fs":
+		dir := cfg.Dir
+		if dir == "" {
+			dir = defaultDir
+		}
+		return NewFSStore(dir)
+	case "s3":
+		return NewS3Store(cfg.S3, aws)
+	default:
+		return nil, fmt.Errorf("unrecognized outputs driver: %s", cfg.Driver)
+	}
+}
+
+// PutDir uploads all files in the local directory dir into the store, under
+// the specified key prefix.
+func PutDir(ctx context.Context, store Store, prefix string, dir string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return store.Put(ctx, path.Join(prefix, filepath.ToSlash(rel)), file)
+	})
+}
+
+// Zip produces a zip archive with all outputs stored under the specified key
+// prefix, writing it to the supplied io.Writer. Entries are named after their
+// keys. If no outputs exist under the prefix, ErrNotFound is returned and
+// nothing is written.
+func Zip(ctx context.Context, store Store, prefix string, w io.Writer) error {
+	var keys []string
+	if err := store.Walk(ctx, prefix, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	wz := zip.NewWriter(w)
+	for _, key := range keys {
+		if err := zipEntry(ctx, store, wz, key); err != nil {
+			_ = wz.Close()
+			return err
+		}
+	}
+
+	// closing writes the central directory; the archive is truncated without
+	// it.
+	return wz.Close()
+}
+
+func zipEntry(ctx context.Context, store Store, wz *zip.Writer, key string) error {
+	header := &zip.FileHeader{
+		Name:   key,
+		Method: zip.Deflate,
+	}
+	header.SetMode(0644)
+
+	writer, err := wz.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(writer, rc)
+	return err
+}
@@ -1,52 +1,59 @@
 package runner
 
 import (
-	"archive/zip"
-	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"math/rand"
 	"net"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
 	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
 	"github.com/ipfs/testground/pkg/conv"
 	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/outputs"
 	"github.com/ipfs/testground/sdk/runtime"
 	"go.uber.org/zap"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var (
-	_    api.Runner = &ClusterK8sRunner{}
-	once            = sync.Once{}
+	_        api.Runner        = &ClusterK8sRunner{}
+	_        api.Healthchecker = &ClusterK8sRunner{}
+	once                       = sync.Once{}
+	poolOnce                   = sync.Once{}
 )
 
 const (
 	defaultK8sNetworkAnnotation = "flannel"
 
+	// registrySecretName is the name of the image pull secret holding the
+	// credentials of the generic registry.
+	registrySecretName = "testground-registry"
+
 	// number of CPUs allocated to Redis. should be same as what is set in redis-values.yaml
 	redisCPUs = 2.0
 	// number of CPUs allocated to each Sidecar. should be same as what is set in sidecar.yaml
@@ -56,12 +63,6 @@ const (
 	// note that there are other services running on the Kubernetes cluster such as
 	// api proxy, kubedns, s3bucket, etc.
 	utilisation = 0.8
-
-	// magic values that we monitor on the Testground runner side to detect when Testground
-	// testplan instances are initialised and at the stage of actually running a test
-	// check sdk/sync for more information
-	NetworkInitialisationSuccessful = "network initialisation successful"
-	NetworkInitialisationFailed     = "network initialisation failed"
 )
 
 var (
@@ -93,9 +94,9 @@ func homeDir() string {
 // values are expressed in a way that zero value (false) is the default setting.
 type ClusterK8sRunnerConfig struct {
 	// LogLevel sets the log level in the test containers (default: not set).
-	LogLevel string `toml:"log_level"`
+	LogLevel string `toml:"log_level" overridable:"yes"`
 
-	KeepService bool `toml:"keep_service"`
+	KeepService bool `toml:"keep_service" overridable:"yes"`
 
 	// Name of the S3 bucket used for `outputs` from test plans
 	OutputsBucket string `toml:"outputs_bucket"`
@@ -104,15 +105,41 @@ type ClusterK8sRunnerConfig struct {
 	OutputsBucketRegion string `toml:"outputs_bucket_region"`
 
 	// Resources requested for each pod from the Kubernetes cluster
-	PodResourceMemory string `toml:"pod_resource_memory"`
-	PodResourceCPU    string `toml:"pod_resource_cpu"`
+	PodResourceMemory string `toml:"pod_resource_memory" overridable:"yes"`
+	PodResourceCPU    string `toml:"pod_resource_cpu" overridable:"yes"`
+
+	// LinkStatsInterval makes the sidecar sample the traffic statistics of
+	// the links of each instance at this interval, as a Go duration (e.g.
+	// "1s"), and append them to link-stats.out in its outputs (default:
+	// disabled).
+	LinkStatsInterval string `toml:"link_stats_interval" overridable:"yes"`
+	// PublishLinkStats also publishes the link statistics samples to the
+	// sync service (default: false).
+	PublishLinkStats bool `toml:"publish_link_stats" overridable:"yes"`
+
+	// Capture makes the sidecar capture the packets on the data link of each
+	// instance, into pcap files in its outputs (default: false).
+	Capture bool `toml:"capture" overridable:"yes"`
+	// CaptureFilter is the pcap filter expression of the captures (default:
+	// all packets).
+	CaptureFilter string `toml:"capture_filter" overridable:"yes"`
+	// CaptureSnaplen is the number of bytes captured per packet (default:
+	// 262144).
+	CaptureSnaplen int `toml:"capture_snaplen" overridable:"yes"`
+	// CaptureMaxSize caps the size of the capture of each instance, in MB
+	// (default: 100).
+	CaptureMaxSize int `toml:"capture_max_size" overridable:"yes"`
+	// CaptureFiles is the number of files the capture of each instance is
+	// split in, and rotates through once they're full (default: 4).
+	CaptureFiles int `toml:"capture_files" overridable:"yes"`
 }
 
 // ClusterK8sRunner is a runner that creates a Docker service to launch as
 // many replicated instances of a container as the run job indicates.
 type ClusterK8sRunner struct {
-	config KubernetesConfig
-	pool   *pool
+	config  KubernetesConfig
+	pool    *pool
+	poolErr error
 
 	podResourceCPU    resource.Quantity
 	podResourceMemory resource.Quantity
@@ -137,6 +164,227 @@ func defaultKubernetesConfig() KubernetesConfig {
 	}
 }
 
+// initPool initialises the pool of Kubernetes clients, once.
+func (c *ClusterK8sRunner) initPool() error {
+	poolOnce.Do(func() {
+		c.config = defaultKubernetesConfig()
+
+		workers := 20
+		c.pool, c.poolErr = newPool(workers, c.config)
+	})
+	return c.poolErr
+}
+
+func (c *ClusterK8sRunner) Healthcheck(fix bool, engine api.Engine, writer io.Writer) (*api.HealthcheckReport, error) {
+	ctx, cancel := context.WithTimeout(engine.Context(), 1*time.Minute)
+	defer cancel()
+
+	log := logging.S().With("runner", "cluster:k8s")
+
+	obj, err := envRunnerConfig(engine.EnvConfig(), c.ID(), c.ConfigType())
+	if err != nil {
+		return nil, err
+	}
+	cfg := obj.(*ClusterK8sRunnerConfig)
+
+	var (
+		apiCheck      api.HealthcheckItem
+		redisCheck    api.HealthcheckItem
+		sidecarCheck  api.HealthcheckItem
+		capacityCheck api.HealthcheckItem
+		bucketCheck   api.HealthcheckItem
+
+		sidecarsUnready bool
+	)
+
+	if err := c.initPool(); err != nil {
+		msg := fmt.Sprintf("k8s client failed to initialise: %s", err)
+		apiCheck = api.HealthcheckItem{Name: "k8s-api", Status: api.HealthcheckStatusFailed, Message: msg}
+	} else {
+		client := c.pool.Acquire()
+		v, err := client.Discovery().ServerVersion()
+		c.pool.Release(client)
+
+		if err == nil {
+			msg := fmt.Sprintf("k8s api reachable; version %s", v.GitVersion)
+			apiCheck = api.HealthcheckItem{Name: "k8s-api", Status: api.HealthcheckStatusOK, Message: msg}
+		} else {
+			msg := fmt.Sprintf("k8s api unreachable: %s", err)
+			apiCheck = api.HealthcheckItem{Name: "k8s-api", Status: api.HealthcheckStatusFailed, Message: msg}
+		}
+	}
+
+	if apiCheck.Status == api.HealthcheckStatusOK {
+		client := c.pool.Acquire()
+
+		ep, err := client.CoreV1().Endpoints(c.config.Namespace).Get("redis-headless", metav1.GetOptions{})
+		switch {
+		case err != nil:
+			msg := fmt.Sprintf("redis service errored: %s", err)
+			redisCheck = api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusFailed, Message: msg}
+		default:
+			var ready int
+			for _, ss := range ep.Subsets {
+				ready += len(ss.Addresses)
+			}
+			if ready > 0 {
+				msg := fmt.Sprintf("redis service: %d pods ready", ready)
+				redisCheck = api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusOK, Message: msg}
+			} else {
+				msg := "redis service: no pods ready"
+				redisCheck = api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusFailed, Message: msg}
+			}
+		}
+
+		ds, err := client.AppsV1().DaemonSets(c.config.Namespace).Get("testground-sidecar", metav1.GetOptions{})
+		switch {
+		case err != nil:
+			msg := fmt.Sprintf("sidecar daemonset errored: %s", err)
+			sidecarCheck = api.HealthcheckItem{Name: "sidecar-daemonset", Status: api.HealthcheckStatusFailed, Message: msg}
+		case ds.Status.DesiredNumberScheduled == 0:
+			msg := "sidecar daemonset: not scheduled on any node"
+			sidecarCheck = api.HealthcheckItem{Name: "sidecar-daemonset", Status: api.HealthcheckStatusFailed, Message: msg}
+		case ds.Status.NumberReady < ds.Status.DesiredNumberScheduled:
+			msg := fmt.Sprintf("sidecar daemonset: %d/%d pods ready", ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+			sidecarCheck = api.HealthcheckItem{Name: "sidecar-daemonset", Status: api.HealthcheckStatusFailed, Message: msg}
+			sidecarsUnready = true
+		default:
+			msg := fmt.Sprintf("sidecar daemonset: %d/%d pods ready", ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+			sidecarCheck = api.HealthcheckItem{Name: "sidecar-daemonset", Status: api.HealthcheckStatusOK, Message: msg}
+		}
+
+		c.pool.Release(client)
+
+		podCPU, err := resource.ParseQuantity(cfg.PodResourceCPU)
+		if err != nil {
+			msg := fmt.Sprintf("invalid pod_resource_cpu %q: %s", cfg.PodResourceCPU, err)
+			capacityCheck = api.HealthcheckItem{Name: "node-capacity", Status: api.HealthcheckStatusAborted, Message: msg}
+		} else if pods, err := c.maxPods(podCPU); err != nil {
+			msg := fmt.Sprintf("failed to calculate node capacity: %s", err)
+			capacityCheck = api.HealthcheckItem{Name: "node-capacity", Status: api.HealthcheckStatusFailed, Message: msg}
+		} else if pods <= 0 {
+			msg := fmt.Sprintf("node capacity: no room for pods requesting %s cpu", cfg.PodResourceCPU)
+			capacityCheck = api.HealthcheckItem{Name: "node-capacity", Status: api.HealthcheckStatusFailed, Message: msg}
+		} else {
+			msg := fmt.Sprintf("node capacity: up to %d pods requesting %s cpu", pods, cfg.PodResourceCPU)
+			capacityCheck = api.HealthcheckItem{Name: "node-capacity", Status: api.HealthcheckStatusOK, Message: msg}
+		}
+	} else {
+		msg := "omitted; k8s api unreachable"
+		redisCheck = api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusOmitted, Message: msg}
+		sidecarCheck = api.HealthcheckItem{Name: "sidecar-daemonset", Status: api.HealthcheckStatusOmitted, Message: msg}
+		capacityCheck = api.HealthcheckItem{Name: "node-capacity", Status: api.HealthcheckStatusOmitted, Message: msg}
+	}
+
+	if store, err := k8sOutputsStore(engine.EnvConfig(), cfg); err != nil {
+		msg := fmt.Sprintf("outputs bucket: %s", err)
+		bucketCheck = api.HealthcheckItem{Name: "outputs-bucket", Status: api.HealthcheckStatusFailed, Message: msg}
+	} else if err := store.CheckAccess(ctx); err != nil {
+		msg := fmt.Sprintf("outputs bucket: %s", err)
+		bucketCheck = api.HealthcheckItem{Name: "outputs-bucket", Status: api.HealthcheckStatusFailed, Message: msg}
+	} else {
+		msg := fmt.Sprintf("outputs bucket %s: accessible", store.Bucket())
+		bucketCheck = api.HealthcheckItem{Name: "outputs-bucket", Status: api.HealthcheckStatusOK, Message: msg}
+	}
+
+	report := &api.HealthcheckReport{
+		Checks: []api.HealthcheckItem{
+			apiCheck,
+			redisCheck,
+			sidecarCheck,
+			capacityCheck,
+			bucketCheck,
+		},
+	}
+
+	if !fix {
+		return report, nil
+	}
+
+	// FIX LOGIC ====================
+
+	// The cluster infrastructure is provisioned out of band (see infra/k8s),
+	// so the only fix we attempt is restarting unready sidecar pods. Other
+	// failures abort runs early, rather than halfway through.
+
+	var fixes []api.HealthcheckItem
+
+	if apiCheck.Status != api.HealthcheckStatusOK {
+		msg := "cannot be fixed automatically; check your kubeconfig and cluster"
+		fixes = append(fixes, api.HealthcheckItem{Name: "k8s-api", Status: api.HealthcheckStatusFailed, Message: msg})
+	}
+
+	if redisCheck.Status == api.HealthcheckStatusFailed {
+		msg := "cannot be fixed automatically; install redis with infra/k8s/install.sh"
+		fixes = append(fixes, api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusFailed, Message: msg})
+	}
+
+	if sidecarCheck.Status == api.HealthcheckStatusFailed {
+		switch {
+		case sidecarsUnready:
+			client := c.pool.Acquire()
+			n, err := deleteUnreadyPods(client, c.config.Namespace, "name=testground-sidecar")
+			c.pool.Release(client)
+
+			if err == nil {
+				log.Infow("restarted unready sidecar pods", "count", n)
+				msg := fmt.Sprintf("restarted %d unready sidecar pods", n)
+				fixes = append(fixes, api.HealthcheckItem{Name: "sidecar-daemonset", Status: api.HealthcheckStatusOK, Message: msg})
+			} else {
+				msg := fmt.Sprintf("failed to restart unready sidecar pods: %s", err)
+				fixes = append(fixes, api.HealthcheckItem{Name: "sidecar-daemonset", Status: api.HealthcheckStatusFailed, Message: msg})
+			}
+		default:
+			msg := "cannot be fixed automatically; deploy infra/k8s/sidecar.yaml"
+			fixes = append(fixes, api.HealthcheckItem{Name: "sidecar-daemonset", Status: api.HealthcheckStatusFailed, Message: msg})
+		}
+	}
+
+	if capacityCheck.Status != api.HealthcheckStatusOK && capacityCheck.Status != api.HealthcheckStatusOmitted {
+		msg := "omitted; resize the cluster or lower pod_resource_cpu"
+		fixes = append(fixes, api.HealthcheckItem{Name: "node-capacity", Status: api.HealthcheckStatusOmitted, Message: msg})
+	}
+
+	if bucketCheck.Status != api.HealthcheckStatusOK {
+		msg := "omitted; pod logs will not be persisted, and outputs cannot be collected"
+		fixes = append(fixes, api.HealthcheckItem{Name: "outputs-bucket", Status: api.HealthcheckStatusOmitted, Message: msg})
+	}
+
+	report.Fixes = fixes
+	return report, nil
+}
+
+// deleteUnreadyPods deletes the pods matching the label selector that are not
+// ready, so that their controller recreates them. It returns how many pods
+// were deleted.
+func deleteUnreadyPods(client *kubernetes.Clientset, namespace, selector string) (int, error) {
+	res, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, pod := range res.Items {
+		if podReady(&pod) {
+			continue
+		}
+		if err := client.CoreV1().Pods(namespace).Delete(pod.Name, &metav1.DeleteOptions{}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func podReady(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
 func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.Writer) (*api.RunOutput, error) {
 	var (
 		log = logging.S().With("runner", "cluster:k8s", "run_id", input.RunID)
@@ -144,16 +392,11 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 	)
 
 	// init Kubernetes runner
-	once.Do(func() {
-		c.config = defaultKubernetesConfig()
-
-		var err error
-		workers := 20
-		c.pool, err = newPool(workers, c.config)
-		if err != nil {
-			log.Fatal(err)
-		}
+	if err := c.initPool(); err != nil {
+		return nil, err
+	}
 
+	once.Do(func() {
 		c.podResourceCPU = resource.MustParse(cfg.PodResourceCPU)
 		c.podResourceMemory = resource.MustParse(cfg.PodResourceMemory)
 	})
@@ -173,6 +416,22 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 		TestOutputsPath:   "/outputs",
 	}
 
+	if err := setLinkStats(&template, cfg.LinkStatsInterval, cfg.PublishLinkStats); err != nil {
+		return nil, err
+	}
+
+	if cfg.Capture {
+		capture := runtime.CaptureParams{
+			Filter:  cfg.CaptureFilter,
+			Snaplen: cfg.CaptureSnaplen,
+			MaxSize: cfg.CaptureMaxSize,
+			Files:   cfg.CaptureFiles,
+		}
+		if err := setCapture(&template, capture); err != nil {
+			return nil, err
+		}
+	}
+
 	// currently weave is not releaasing IP addresses upon container deletion - we get errors back when trying to
 	// use an already used IP address, even if the container has been removed
 	// this functionality should be refactored asap, when we understand how weave releases IPs (or why it doesn't release
@@ -185,7 +444,7 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 
 	template.TestSubnet = &runtime.IPNet{IPNet: *subnet}
 
-	c.maxAllowedPods, err = c.maxPods() // TODO: maybe move to the `init` / runner constructor at some point
+	c.maxAllowedPods, err = c.maxPods(c.podResourceCPU) // TODO: maybe move to the `init` / runner constructor at some point
 	if err != nil {
 		return nil, fmt.Errorf("couldn't calculate max pod allowance on the cluster: %v", err)
 	}
@@ -198,41 +457,78 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 
 	log.Infow("deploying testground testplan run on k8s", "job-name", jobName)
 
-	var eg errgroup.Group
+	// The outputs store is where we persist the logs of each pod. If it's not
+	// available, we still follow the logs, but we don't persist them.
+	store := podLogsStore(log, input.EnvConfig, &cfg)
 
-	// atomic counter which records how many networks have been initialised.
-	// it should equal the number of all testplan instances for the given run eventually.
-	var initialisedNetworks uint64
+	// followCtx governs the log followers; they're stopped if we return early.
+	followCtx, cancelFollow := context.WithCancel(ctx)
+	defer cancelFollow()
+
+	// The run status published by instances on the sync service tells us how
+	// far along the run is. If it's not available, we fall back to pod phases.
+	status, err := trackRunStatus(followCtx, log, template, input.TotalInstances)
+	if err != nil {
+		log.Warnw("run status unavailable; tracking pod phases only", "err", err)
+	}
+
+	var eg errgroup.Group
 
 	eg.Go(func() error {
-		return c.monitorTestplanRunState(ctx, log, input, &initialisedNetworks)
+		return c.monitorTestplanRunState(ctx, log, input, status)
 	})
 
+	var (
+		pretty  = NewPrettyPrinter()
+		follows errgroup.Group // log followers, until they hand off the stream to the pretty printer.
+		uploads errgroup.Group // uploads of pod logs to the outputs store.
+	)
+
+	// Images pushed to the generic registry are pulled with its credentials,
+	// stored in an image pull secret.
+	if input.EnvConfig.Registry.Username != "" {
+		for _, g := range input.Groups {
+			if onGenericRegistry(input.EnvConfig, g.ArtifactPath) {
+				if err := c.ensureRegistrySecret(input.EnvConfig.Registry); err != nil {
+					return nil, fmt.Errorf("failed to store registry credentials: %w", err)
+				}
+				break
+			}
+		}
+	}
+
 	sem := make(chan struct{}, 30) // limit the number of concurrent k8s api calls
 
 	for _, g := range input.Groups {
+		g := g
+
 		runenv := template
 		runenv.TestGroupID = g.ID
+		runenv.TestNAT = g.NAT
 		runenv.TestGroupInstanceCount = g.Instances
 		runenv.TestInstanceParams = g.Parameters
 
-		env := conv.ToEnvVar(runenv.ToEnvVars())
-		env = append(env, v1.EnvVar{
-			Name:  "REDIS_HOST",
-			Value: "redis-headless",
-		})
-
-		// Set the log level if provided in cfg.
-		if cfg.LogLevel != "" {
-			env = append(env, v1.EnvVar{
-				Name:  "LOG_LEVEL",
-				Value: cfg.LogLevel,
-			})
-		}
 		for i := 0; i < g.Instances; i++ {
 			i := i
 			sem <- struct{}{}
 
+			runenv := runenv
+			runenv.TestGroupInstanceIndex = i
+
+			env := conv.ToEnvVar(instanceEnv(&runenv))
+			env = append(env, v1.EnvVar{
+				Name:  "REDIS_HOST",
+				Value: "redis-headless",
+			})
+
+			// Set the log level if provided in cfg.
+			if cfg.LogLevel != "" {
+				env = append(env, v1.EnvVar{
+					Name:  "LOG_LEVEL",
+					Value: cfg.LogLevel,
+				})
+			}
+
 			podName := fmt.Sprintf("%s-%s-%s-%d", jobName, input.RunID, g.ID, i)
 
 			defer func() {
@@ -252,6 +548,14 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 
 				return c.createPod(ctx, podName, input, runenv, env, g, i)
 			})
+
+			follows.Go(func() error {
+				var (
+					id  = fmt.Sprintf("%s-%d", g.ID, i)
+					key = path.Join(input.RunID, g.ID, strconv.Itoa(i), "pod.log")
+				)
+				return c.followPodLogs(followCtx, log, pretty, &uploads, store, podName, id, key)
+			})
 		}
 	}
 
@@ -260,214 +564,193 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 		return nil, err
 	}
 
-	var gg errgroup.Group
-
-	for _, g := range input.Groups {
-		for i := 0; i < g.Instances; i++ {
-			i := i
-			sem <- struct{}{}
-
-			gg.Go(func() error {
-				defer func() { <-sem }()
-
-				podName := fmt.Sprintf("%s-%s-%s-%d", jobName, input.RunID, g.ID, i)
-
-				logs, err := c.getPodLogs(log, podName)
-				if err != nil {
-					return err
-				}
-
-				fmt.Print(logs)
-				return nil
-			})
-		}
-	}
-
-	err = gg.Wait()
-	if err != nil {
+	// All pods have finished; wait until all logs have been streamed and
+	// persisted.
+	if err := follows.Wait(); err != nil {
 		return nil, err
 	}
 
-	return &api.RunOutput{RunID: input.RunID}, nil
-}
-
-func (*ClusterK8sRunner) ID() string {
-	return "cluster:k8s"
-}
+	runErr := pretty.Wait()
+	if runErr == nil && status != nil {
+		runErr = status.Err()
+	}
 
-func (*ClusterK8sRunner) ConfigType() reflect.Type {
-	return reflect.TypeOf(ClusterK8sRunnerConfig{})
-}
+	if err := uploads.Wait(); err != nil {
+		log.Warnw("failed to persist pod logs", "err", err)
+	}
 
-func (*ClusterK8sRunner) CompatibleBuilders() []string {
-	return []string{"docker:go"}
+	return &api.RunOutput{RunID: input.RunID}, runErr
 }
 
-func (*ClusterK8sRunner) CollectOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error {
-	log := logging.S().With("runner", "cluster:k8s", "run_id", input.RunID)
-	cfg := *input.RunnerConfig.(*ClusterK8sRunnerConfig)
-
-	log.Info("collecting outputs")
-
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(cfg.OutputsBucketRegion)},
-	)
-	if err != nil {
-		return fmt.Errorf("Couldn't establish an AWS session to list items in bucket: %v", err)
+// followPodLogs waits for a pod to start, and then follows its logs, handing
+// them off to the pretty printer. If an outputs store is provided, a copy of
+// the logs is persisted under the specified key.
+//
+// It returns as soon as the log stream has been handed off.
+func (c *ClusterK8sRunner) followPodLogs(ctx context.Context, log *zap.SugaredLogger, pretty *PrettyPrinter, uploads *errgroup.Group, store outputs.Store, podName, id, key string) error {
+	if err := c.waitPodStarted(ctx, podName); err != nil {
+		return err
 	}
 
-	svc := s3.New(sess)
-
-	downloader := s3manager.NewDownloader(sess)
-	downloader.Concurrency = 1 // force sequential downloads.
+	podLogOpts := v1.PodLogOptions{
+		Follow: true,
+	}
 
-	zipWriter := zip.NewWriter(w)
-	defer zipWriter.Close()
+	var stream io.ReadCloser
+	err := retry(5, 5*time.Second, func() (err error) {
+		client := c.pool.Acquire()
+		defer c.pool.Release(client)
 
-	query := s3.ListObjectsV2Input{Bucket: aws.String(cfg.OutputsBucket), Prefix: aws.String(input.RunID)}
-	for {
-		resp, err := svc.ListObjectsV2WithContext(ctx, &query)
+		stream, err = client.CoreV1().Pods(c.config.Namespace).GetLogs(podName, &podLogOpts).Stream()
 		if err != nil {
-			return fmt.Errorf("Unable to list items in bucket %q, %v", cfg.OutputsBucket, err)
+			log.Warnw("got error when trying to follow pod logs", "pod", podName, "err", err.Error())
 		}
+		return err
+	})
+	if err != nil {
+		pretty.FailStart(id, err)
+		return nil
+	}
 
-		log.Debugw("got contents", "len", len(resp.Contents))
-		for _, item := range resp.Contents {
-			ww, err := zipWriter.Create(*item.Key)
-			if err != nil {
-				return fmt.Errorf("Couldn't add file to the zip archive: %v", err)
-			}
+	var stdout io.ReadCloser = stream
+	if store != nil {
+		pr, pw := io.Pipe()
+		stdout = &teeReadCloser{
+			Reader:  io.TeeReader(stream, pw),
+			closers: []io.Closer{stream, pw},
+		}
 
-			_, err = downloader.DownloadWithContext(ctx, FakeWriterAt{ww},
-				&s3.GetObjectInput{
-					Bucket: aws.String(cfg.OutputsBucket),
-					Key:    item.Key,
-				})
+		uploads.Go(func() error {
+			err := store.Put(ctx, key, pr)
 			if err != nil {
-				return fmt.Errorf("Couldn't download item from S3: %q, err: %v", item, err)
+				// drain the pipe, so that the printer doesn't block.
+				_, _ = io.Copy(ioutil.Discard, pr)
 			}
-		}
-		if !*resp.IsTruncated {
-			break
-		}
-		query.SetContinuationToken(*resp.NextContinuationToken)
+			return err
+		})
 	}
 
+	// Kubernetes merges stdout and stderr into a single log stream.
+	pretty.Manage(id, stdout, ioutil.NopCloser(new(bytes.Buffer)))
 	return nil
 }
 
-func (c *ClusterK8sRunner) getPodLogs(log *zap.SugaredLogger, podName string) (string, error) {
-	client := c.pool.Acquire()
-	defer c.pool.Release(client)
+// waitPodStarted polls the pod until it is no longer pending.
+func (c *ClusterK8sRunner) waitPodStarted(ctx context.Context, podName string) error {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
 
-	podLogOpts := v1.PodLogOptions{
-		TailLines: int64Ptr(2),
-	}
+	for {
+		client := c.pool.Acquire()
+		pod, err := client.CoreV1().Pods(c.config.Namespace).Get(podName, metav1.GetOptions{})
+		c.pool.Release(client)
 
-	var podLogs io.ReadCloser
-	var err error
-	err = retry(5, 5*time.Second, func() error {
-		req := client.CoreV1().Pods(c.config.Namespace).GetLogs(podName, &podLogOpts)
-		podLogs, err = req.Stream()
-		if err != nil {
-			log.Warnw("got error when trying to fetch pod logs", "err", err.Error())
+		if err == nil {
+			switch pod.Status.Phase {
+			case v1.PodRunning, v1.PodSucceeded, v1.PodFailed:
+				return nil
+			}
 		}
-		return err
-	})
-	if err != nil {
-		return "", fmt.Errorf("error in opening stream: %v", err)
-	}
-	defer podLogs.Close()
 
-	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, podLogs)
-	if err != nil {
-		return "", fmt.Errorf("error in copy information from podLogs to buf: %v", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
+}
 
-	return buf.String(), nil
+// teeReadCloser is an io.ReadCloser that closes all underlying closers.
+type teeReadCloser struct {
+	io.Reader
+	closers []io.Closer
 }
 
-func (c *ClusterK8sRunner) waitNetworksInitialised(ctx context.Context, log *zap.SugaredLogger, runID string, initialisedNetworks *uint64) error {
-	client := c.pool.Acquire()
-	res, err := client.CoreV1().Pods(c.config.Namespace).List(metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("testground.run_id=%s", runID),
-	})
-	c.pool.Release(client)
-	if err != nil {
-		return err
+func (t *teeReadCloser) Close() error {
+	var err error
+	for _, c := range t.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
 	}
+	return err
+}
 
-	var eg errgroup.Group
+func (*ClusterK8sRunner) ID() string {
+	return "cluster:k8s"
+}
 
-	for _, pod := range res.Items {
-		podName := pod.Name
+func (*ClusterK8sRunner) ConfigType() reflect.Type {
+	return reflect.TypeOf(ClusterK8sRunnerConfig{})
+}
 
-		eg.Go(func() error {
-			err := c.waitNetworkInitialised(ctx, log, podName)
-			if err != nil {
-				return err
-			}
+func (*ClusterK8sRunner) CompatibleBuilders() []string {
+	return []string{"docker:go", "docker:generic"}
+}
 
-			atomic.AddUint64(initialisedNetworks, 1)
+func (*ClusterK8sRunner) CollectOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error {
+	log := logging.S().With("runner", "cluster:k8s", "run_id", input.RunID)
+	cfg := *input.RunnerConfig.(*ClusterK8sRunnerConfig)
 
-			return nil
-		})
+	log.Info("collecting outputs")
+
+	store, err := k8sOutputsStore(input.EnvConfig, &cfg)
+	if err != nil {
+		return err
 	}
 
-	return eg.Wait()
+	return collectRunOutputs(ctx, store, input, w)
 }
 
-func (c *ClusterK8sRunner) waitNetworkInitialised(ctx context.Context, log *zap.SugaredLogger, podName string) error {
-	podLogOpts := v1.PodLogOptions{
-		SinceSeconds: int64Ptr(1000),
-		Follow:       true,
+// podLogsStore returns the outputs store in which the logs of pods are
+// persisted, or nil if it's unavailable, e.g. if no outputs bucket is
+// configured.
+func podLogsStore(log *zap.SugaredLogger, env config.EnvConfig, cfg *ClusterK8sRunnerConfig) outputs.Store {
+	// k8sOutputsStore returns a nil *S3Store on error, which must not end up
+	// in a non-nil Store.
+	var store outputs.Store
+	if s3, err := k8sOutputsStore(env, cfg); err != nil {
+		log.Warnw("outputs store unavailable; pod logs will not be persisted", "err", err)
+	} else {
+		store = s3
 	}
+	return store
+}
 
-	var podLogs io.ReadCloser
-	var err error
-	err = retry(5, 5*time.Second, func() error {
-		client := c.pool.Acquire()
-		req := client.CoreV1().Pods(c.config.Namespace).GetLogs(podName, &podLogOpts)
-		c.pool.Release(client)
-		podLogs, err = req.Stream()
-		if err != nil {
-			log.Warnw("got error when trying to fetch pod logs", "err", err.Error())
-		}
-		return err
-	})
-	if err != nil {
-		return fmt.Errorf("error in opening stream: %v", err)
+// k8sOutputsStore returns the S3 store where test plan instances upload their
+// outputs. The bucket and region in the runner configuration take precedence
+// over the ones in the outputs configuration of the environment.
+func k8sOutputsStore(env config.EnvConfig, cfg *ClusterK8sRunnerConfig) (*outputs.S3Store, error) {
+	s3cfg := env.Outputs.S3
+	if cfg.OutputsBucket != "" {
+		s3cfg.Bucket = cfg.OutputsBucket
 	}
-	defer podLogs.Close()
-
-	scanner := bufio.NewScanner(podLogs)
-	for scanner.Scan() {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			line := scanner.Text()
-			if strings.Contains(line, NetworkInitialisationSuccessful) {
-				return nil
-			}
-		}
+	if cfg.OutputsBucketRegion != "" {
+		s3cfg.Region = cfg.OutputsBucketRegion
 	}
-
-	return errors.New("network initialisation successful log line not detected")
+	return outputs.NewS3Store(s3cfg, env.AWS)
 }
 
-func (c *ClusterK8sRunner) monitorTestplanRunState(ctx context.Context, log *zap.SugaredLogger, input *api.RunInput, initialisedNetworks *uint64) error {
+// monitorTestplanRunState returns once all testplan instances have finished,
+// either as reported on the run status (if available), or as observed from
+// the pod phases.
+func (c *ClusterK8sRunner) monitorTestplanRunState(ctx context.Context, log *zap.SugaredLogger, input *api.RunInput, status *runStatus) error {
 	client := c.pool.Acquire()
 	defer c.pool.Release(client)
 
+	var done <-chan struct{}
+	if status != nil {
+		done = status.Done()
+	}
+
 	start := time.Now()
 	allRunningStage := false
-	allNetworksStage := false
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-done:
+			return nil
 		default:
 		}
 
@@ -510,21 +793,11 @@ func (c *ClusterK8sRunner) monitorTestplanRunState(ctx context.Context, log *zap
 		}
 		wg.Wait()
 
-		initNets := int(atomic.LoadUint64(initialisedNetworks))
 		log.Debugw("testplan pods state", "running_for", time.Since(start), "succeeded", counters["Succeeded"], "running", counters["Running"], "pending", counters["Pending"], "failed", counters["Failed"], "unknown", counters["Unknown"])
 
 		if counters["Running"] == input.TotalInstances && !allRunningStage {
 			allRunningStage = true
 			log.Infow("all testplan instances in `Running` state", "took", time.Since(start))
-
-			go func() {
-				_ = c.waitNetworksInitialised(ctx, log, input.RunID, initialisedNetworks)
-			}()
-		}
-
-		if initNets == input.TotalInstances && !allNetworksStage {
-			allNetworksStage = true
-			log.Infow("all testplan instances networks initialised", "took", time.Since(start))
 		}
 
 		if counters["Succeeded"] == input.TotalInstances {
@@ -532,6 +805,11 @@ func (c *ClusterK8sRunner) monitorTestplanRunState(ctx context.Context, log *zap
 			return nil
 		}
 
+		if counters["Succeeded"]+counters["Failed"] == input.TotalInstances {
+			log.Infow("all testplan instances terminated", "took", time.Since(start), "failed", counters["Failed"])
+			return nil
+		}
+
 	}
 }
 
@@ -601,25 +879,53 @@ func (c *ClusterK8sRunner) createPod(ctx context.Context, podName string, input
 		},
 	}
 
+	if input.EnvConfig.Registry.Username != "" && onGenericRegistry(input.EnvConfig, g.ArtifactPath) {
+		podRequest.Spec.ImagePullSecrets = []v1.LocalObjectReference{{Name: registrySecretName}}
+	}
+
 	_, err := client.CoreV1().Pods(c.config.Namespace).Create(podRequest)
 	return err
 }
 
-func int64Ptr(i int64) *int64 { return &i }
+// ensureRegistrySecret creates or updates the image pull secret holding the
+// credentials of the generic registry.
+func (c *ClusterK8sRunner) ensureRegistrySecret(cfg config.RegistryConfig) error {
+	auth := base64.StdEncoding.EncodeToString([]byte(cfg.Username + ":" + cfg.Password))
+	dockercfg, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			cfg.Host: map[string]string{
+				"username": cfg.Username,
+				"password": cfg.Password,
+				"auth":     auth,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
 
-type FakeWriterAt struct {
-	w io.Writer
-}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: registrySecretName},
+		Type:       v1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{v1.DockerConfigJsonKey: dockercfg},
+	}
+
+	client := c.pool.Acquire()
+	defer c.pool.Release(client)
 
-func (fw FakeWriterAt) WriteAt(p []byte, offset int64) (n int, err error) {
-	// ignore 'offset' because we forced sequential downloads
-	return fw.w.Write(p)
+	secrets := client.CoreV1().Secrets(c.config.Namespace)
+	if _, err = secrets.Update(secret); k8serrors.IsNotFound(err) {
+		_, err = secrets.Create(secret)
+	}
+	return err
 }
 
+func int64Ptr(i int64) *int64 { return &i }
+
 // maxPods returns the max allowed pods for the current cluster size
 // at the moment we are CPU bound, so this is based only on rough estimation of available CPUs
-func (c *ClusterK8sRunner) maxPods() (int, error) {
-	podCPU, err := strconv.ParseFloat(c.podResourceCPU.AsDec().String(), 64)
+func (c *ClusterK8sRunner) maxPods(podResourceCPU resource.Quantity) (int, error) {
+	podCPU, err := strconv.ParseFloat(podResourceCPU.AsDec().String(), 64)
 	if err != nil {
 		return 0, err
 	}
@@ -635,6 +941,9 @@ func (c *ClusterK8sRunner) maxPods() (int, error) {
 	}
 
 	nodes := len(res.Items)
+	if nodes == 0 {
+		return 0, errors.New("no worker nodes found in the cluster")
+	}
 
 	// all worker nodes are the same, so just take allocatable CPU from the first
 	item := res.Items[0].Status.Allocatable["cpu"]
@@ -652,6 +961,10 @@ func (c *ClusterK8sRunner) maxPods() (int, error) {
 // This command will remove all plan pods in the cluster.
 func (c *ClusterK8sRunner) TerminateAll() error {
 	log := logging.S()
+	if err := c.initPool(); err != nil {
+		return err
+	}
+
 	client := c.pool.Acquire()
 	defer c.pool.Release(client)
 
@@ -660,7 +973,7 @@ func (c *ClusterK8sRunner) TerminateAll() error {
 	}
 	err := client.CoreV1().Pods(c.config.Namespace).DeleteCollection(&metav1.DeleteOptions{}, planPods)
 	if err != nil {
-		log.Errorw("could not terminate all pods.", "err", err) 
+		log.Errorw("could not terminate all pods.", "err", err)
 		return err
 	}
 	return nil
@@ -0,0 +1,97 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/ipfs/testground/pkg/config"
+	"github.com/ipfs/testground/pkg/logging"
+)
+
+func TestFollowPodLogsWithoutOutputsStore(t *testing.T) {
+	// a kubernetes API serving a running pod and its logs.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/default/pods/tg-pod", func(w http.ResponseWriter, r *http.Request) {
+		pod := v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning}}
+		pod.Kind, pod.APIVersion = "Pod", "v1"
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&pod)
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/pods/tg-pod/log", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "hello from the pod")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cs, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &ClusterK8sRunner{
+		config: KubernetesConfig{Namespace: "default"},
+		pool:   &pool{availableC: make(chan *kubernetes.Clientset, 1)},
+	}
+	c.pool.Release(cs)
+
+	// no outputs bucket is configured, so there's no store to persist the
+	// logs to.
+	log := logging.S()
+	store := podLogsStore(log, config.EnvConfig{}, &ClusterK8sRunnerConfig{})
+	if store != nil {
+		t.Fatalf("expected no outputs store, got %v", store)
+	}
+
+	var (
+		pretty  = NewPrettyPrinter()
+		printed lockedBuffer
+		uploads errgroup.Group
+	)
+	pretty.out = &printed
+
+	if err := c.followPodLogs(context.Background(), log, pretty, &uploads, store, "tg-pod", "instance 0", "run/single/0/run.out"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pod logs don't report an outcome, so the printer reports a failure.
+	_ = pretty.Wait()
+
+	if out := printed.String(); !strings.Contains(out, "hello from the pod") {
+		t.Fatalf("expected the pod logs to be printed, got %q", out)
+	}
+
+	if err := uploads.Wait(); err != nil {
+		t.Fatalf("expected no uploads, got %s", err)
+	}
+}
+
+// lockedBuffer is a buffer that can be written to concurrently, like the
+// printer does from the goroutines processing the output of each instance.
+type lockedBuffer struct {
+	lk  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return b.buf.String()
+}
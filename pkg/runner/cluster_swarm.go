@@ -11,7 +11,9 @@ import (
 
 	"github.com/ipfs/testground/pkg/api"
 	"github.com/ipfs/testground/pkg/aws"
+	"github.com/ipfs/testground/pkg/config"
 	"github.com/ipfs/testground/pkg/conv"
+	"github.com/ipfs/testground/pkg/docker"
 	"github.com/ipfs/testground/pkg/logging"
 	"github.com/ipfs/testground/sdk/runtime"
 	"golang.org/x/sync/errgroup"
@@ -25,18 +27,19 @@ import (
 )
 
 var (
-	_ api.Runner = &ClusterSwarmRunner{}
+	_ api.Runner        = &ClusterSwarmRunner{}
+	_ api.Healthchecker = &ClusterSwarmRunner{}
 )
 
 // ClusterSwarmRunnerConfig is the configuration object of this runner. Boolean
 // values are expressed in a way that zero value (false) is the default setting.
 type ClusterSwarmRunnerConfig struct {
 	// LogLevel sets the log level in the test containers (default: not set).
-	LogLevel string `toml:"log_level"`
+	LogLevel string `toml:"log_level" overridable:"yes"`
 
 	// Background avoids tailing the output of containers, and displaying it as
 	// log messages (default: true).
-	Background bool `toml:"background"`
+	Background bool `toml:"background" overridable:"yes"`
 
 	// DockerEndpoint is the URL of the docker swarm manager endpoint, e.g.
 	// "tcp://manager:2376"
@@ -59,13 +62,281 @@ type ClusterSwarmRunnerConfig struct {
 	// KeepService keeps the service after all instances have finished and
 	// all logs have been piped. Only used when running in foreground mode
 	// (default is background mode).
-	KeepService bool `toml:"keep_service"`
+	KeepService bool `toml:"keep_service" overridable:"yes"`
+
+	// EnableIPv6 assigns an IPv6 subnet to the data network, in addition to
+	// the IPv4 one (default: false).
+	EnableIPv6 bool `toml:"enable_ipv6" overridable:"yes"`
+
+	// LinkStatsInterval makes the sidecar sample the traffic statistics of
+	// the links of each instance at this interval, as a Go duration (e.g.
+	// "1s"). Instances have no outputs on this runner, so the samples are
+	// only published, with PublishLinkStats (default: disabled).
+	LinkStatsInterval string `toml:"link_stats_interval" overridable:"yes"`
+	// PublishLinkStats also publishes the link statistics samples to the
+	// sync service (default: false).
+	PublishLinkStats bool `toml:"publish_link_stats" overridable:"yes"`
 }
 
 // ClusterSwarmRunner is a runner that creates a Docker service to launch as
 // many replicated instances of a container as the run job indicates.
 type ClusterSwarmRunner struct{}
 
+// swarmClient creates a docker client for the swarm manager endpoint.
+func swarmClient(cfg *ClusterSwarmRunnerConfig) (*client.Client, error) {
+	if cfg.DockerEndpoint == "" {
+		return nil, errors.New("docker_endpoint is not configured")
+	}
+
+	var opts []client.Opt
+	if cfg.DockerTLS {
+		opts = append(opts, client.WithTLSClientConfig(cfg.DockerTLSCACertPath, cfg.DockerTLSCertPath, cfg.DockerTLSKeyPath))
+	}
+
+	opts = append(opts, client.WithHost(cfg.DockerEndpoint), client.WithAPIVersionNegotiation())
+	return client.NewClientWithOpts(opts...)
+}
+
+func (r *ClusterSwarmRunner) Healthcheck(fix bool, engine api.Engine, writer io.Writer) (*api.HealthcheckReport, error) {
+	ctx, cancel := context.WithTimeout(engine.Context(), 1*time.Minute)
+	defer cancel()
+
+	log := logging.S().With("runner", "cluster:swarm")
+
+	obj, err := envRunnerConfig(engine.EnvConfig(), r.ID(), r.ConfigType())
+	if err != nil {
+		return nil, err
+	}
+	cfg := obj.(*ClusterSwarmRunnerConfig)
+
+	var (
+		apiCheck     api.HealthcheckItem
+		ctrlNetCheck api.HealthcheckItem
+		redisCheck   api.HealthcheckItem
+		workersCheck api.HealthcheckItem
+		sidecarCheck api.HealthcheckItem
+
+		redisMissing bool
+	)
+
+	cli, err := swarmClient(cfg)
+	if err != nil {
+		msg := fmt.Sprintf("swarm client failed to initialise: %s", err)
+		apiCheck = api.HealthcheckItem{Name: "swarm-api", Status: api.HealthcheckStatusFailed, Message: msg}
+	} else {
+		info, err := cli.Info(ctx)
+		switch {
+		case err != nil:
+			msg := fmt.Sprintf("swarm manager unreachable: %s", err)
+			apiCheck = api.HealthcheckItem{Name: "swarm-api", Status: api.HealthcheckStatusFailed, Message: msg}
+		case !info.Swarm.ControlAvailable:
+			msg := fmt.Sprintf("%s is not a swarm manager; swarm state: %s", cfg.DockerEndpoint, info.Swarm.LocalNodeState)
+			apiCheck = api.HealthcheckItem{Name: "swarm-api", Status: api.HealthcheckStatusFailed, Message: msg}
+		default:
+			msg := fmt.Sprintf("swarm manager reachable; %d nodes", info.Swarm.Nodes)
+			apiCheck = api.HealthcheckItem{Name: "swarm-api", Status: api.HealthcheckStatusOK, Message: msg}
+		}
+	}
+
+	if apiCheck.Status == api.HealthcheckStatusOK {
+		// the name filter matches substrings, so look for an exact match.
+		networks, err := cli.NetworkList(ctx, types.NetworkListOptions{
+			Filters: filters.NewArgs(filters.Arg("name", "control"), filters.Arg("driver", "overlay")),
+		})
+		var exists bool
+		for _, n := range networks {
+			exists = exists || n.Name == "control"
+		}
+		switch {
+		case err != nil:
+			msg := fmt.Sprintf("control network errored: %s", err)
+			ctrlNetCheck = api.HealthcheckItem{Name: "control-network", Status: api.HealthcheckStatusAborted, Message: msg}
+		case !exists:
+			msg := "control network: not created"
+			ctrlNetCheck = api.HealthcheckItem{Name: "control-network", Status: api.HealthcheckStatusFailed, Message: msg}
+		default:
+			msg := "control network: exists"
+			ctrlNetCheck = api.HealthcheckItem{Name: "control-network", Status: api.HealthcheckStatusOK, Message: msg}
+		}
+
+		redisCheck, redisMissing = checkSwarmService(ctx, cli, "redis-service", "testground-redis")
+
+		nodes, err := cli.NodeList(ctx, types.NodeListOptions{
+			Filters: filters.NewArgs(filters.Arg("node.label", "TGRole=worker")),
+		})
+		if err == nil {
+			var ready int
+			for _, n := range nodes {
+				if n.Status.State == swarm.NodeStateReady && n.Spec.Availability == swarm.NodeAvailabilityActive {
+					ready++
+				}
+			}
+			if ready > 0 {
+				msg := fmt.Sprintf("worker nodes: %d/%d ready", ready, len(nodes))
+				workersCheck = api.HealthcheckItem{Name: "worker-nodes", Status: api.HealthcheckStatusOK, Message: msg}
+			} else {
+				msg := fmt.Sprintf("worker nodes: 0/%d ready", len(nodes))
+				workersCheck = api.HealthcheckItem{Name: "worker-nodes", Status: api.HealthcheckStatusFailed, Message: msg}
+			}
+		} else {
+			msg := fmt.Sprintf("worker nodes errored: %s", err)
+			workersCheck = api.HealthcheckItem{Name: "worker-nodes", Status: api.HealthcheckStatusAborted, Message: msg}
+		}
+	} else {
+		msg := "omitted; swarm manager unreachable"
+		ctrlNetCheck = api.HealthcheckItem{Name: "control-network", Status: api.HealthcheckStatusOmitted, Message: msg}
+		redisCheck = api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusOmitted, Message: msg}
+		workersCheck = api.HealthcheckItem{Name: "worker-nodes", Status: api.HealthcheckStatusOmitted, Message: msg}
+	}
+
+	// The sidecar runs as a standalone testground-sidecar container on every
+	// node (see infra/docker-swarm), not as a swarm service, so the manager
+	// has no view of it: only the docker daemon of each node does.
+	msg := "omitted; the testground-sidecar containers run outside of the swarm, and can only be checked on each node"
+	sidecarCheck = api.HealthcheckItem{Name: "sidecar", Status: api.HealthcheckStatusOmitted, Message: msg}
+
+	report := &api.HealthcheckReport{
+		Checks: []api.HealthcheckItem{
+			apiCheck,
+			ctrlNetCheck,
+			redisCheck,
+			workersCheck,
+			sidecarCheck,
+		},
+	}
+
+	if !fix {
+		return report, nil
+	}
+
+	// FIX LOGIC ====================
+
+	// The swarm itself is provisioned out of band (see infra/docker-swarm). We
+	// only create the control network and the redis service if they're
+	// missing; anything else requires manual intervention.
+
+	var fixes []api.HealthcheckItem
+
+	if apiCheck.Status != api.HealthcheckStatusOK {
+		msg := "cannot be fixed automatically; check docker_endpoint and the swarm"
+		fixes = append(fixes, api.HealthcheckItem{Name: "swarm-api", Status: api.HealthcheckStatusFailed, Message: msg})
+	}
+
+	if ctrlNetCheck.Status == api.HealthcheckStatusFailed {
+		_, err := cli.NetworkCreate(ctx, "control", types.NetworkCreate{
+			Driver:         "overlay",
+			CheckDuplicate: true,
+			Attachable:     true,
+			Scope:          "swarm",
+		})
+		if err == nil {
+			msg := "control network created successfully"
+			fixes = append(fixes, api.HealthcheckItem{Name: "control-network", Status: api.HealthcheckStatusOK, Message: msg})
+		} else {
+			msg := fmt.Sprintf("failed to create control network: %s", err)
+			fixes = append(fixes, api.HealthcheckItem{Name: "control-network", Status: api.HealthcheckStatusFailed, Message: msg})
+		}
+	}
+
+	if redisCheck.Status == api.HealthcheckStatusFailed {
+		switch {
+		case !redisMissing:
+			msg := "cannot be fixed automatically; inspect the testground-redis service tasks"
+			fixes = append(fixes, api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusFailed, Message: msg})
+		case ctrlNetCheck.Status != api.HealthcheckStatusOK && !fixSucceeded(fixes, "control-network"):
+			msg := "omitted creation of redis service; no control network"
+			fixes = append(fixes, api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusOmitted, Message: msg})
+		default:
+			if err := createSwarmRedisService(ctx, cli); err == nil {
+				log.Infow("created redis service")
+				msg := "redis service created successfully"
+				fixes = append(fixes, api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusOK, Message: msg})
+			} else {
+				msg := fmt.Sprintf("failed to create redis service: %s", err)
+				fixes = append(fixes, api.HealthcheckItem{Name: "redis-service", Status: api.HealthcheckStatusFailed, Message: msg})
+			}
+		}
+	}
+
+	if workersCheck.Status == api.HealthcheckStatusFailed {
+		msg := "cannot be fixed automatically; label worker nodes with TGRole=worker"
+		fixes = append(fixes, api.HealthcheckItem{Name: "worker-nodes", Status: api.HealthcheckStatusFailed, Message: msg})
+	}
+
+	report.Fixes = fixes
+	return report, nil
+}
+
+// checkSwarmService checks that the named service exists and has at least one
+// running task. It also returns whether the service is missing altogether.
+func checkSwarmService(ctx context.Context, cli *client.Client, check, name string) (api.HealthcheckItem, bool) {
+	svcs, err := cli.ServiceList(ctx, types.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", name)),
+	})
+	switch {
+	case err != nil:
+		msg := fmt.Sprintf("%s service errored: %s", name, err)
+		return api.HealthcheckItem{Name: check, Status: api.HealthcheckStatusAborted, Message: msg}, false
+	case len(svcs) == 0:
+		msg := fmt.Sprintf("%s service: non-existent", name)
+		return api.HealthcheckItem{Name: check, Status: api.HealthcheckStatusFailed, Message: msg}, true
+	}
+
+	tasks, err := cli.TaskList(ctx, types.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", svcs[0].ID), filters.Arg("desired-state", "running")),
+	})
+	if err != nil {
+		msg := fmt.Sprintf("%s service errored: %s", name, err)
+		return api.HealthcheckItem{Name: check, Status: api.HealthcheckStatusAborted, Message: msg}, false
+	}
+
+	var running int
+	for _, t := range tasks {
+		if t.Status.State == swarm.TaskStateRunning {
+			running++
+		}
+	}
+	if running == 0 {
+		msg := fmt.Sprintf("%s service: no running tasks", name)
+		return api.HealthcheckItem{Name: check, Status: api.HealthcheckStatusFailed, Message: msg}, false
+	}
+
+	msg := fmt.Sprintf("%s service: %d tasks running", name, running)
+	return api.HealthcheckItem{Name: check, Status: api.HealthcheckStatusOK, Message: msg}, false
+}
+
+// createSwarmRedisService creates the testground-redis service, as deployed
+// by infra/docker-swarm.
+func createSwarmRedisService(ctx context.Context, cli *client.Client) error {
+	spec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: "testground-redis"},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{
+				Image:   "redis:latest",
+				Command: []string{"redis-server"},
+				Args:    []string{"--save", "", "--appendonly", "no"},
+			},
+			Placement: &swarm.Placement{
+				Constraints: []string{"node.labels.TGRole==redis"},
+			},
+		},
+		Networks: []swarm.NetworkAttachmentConfig{{Target: "control"}},
+	}
+	_, err := cli.ServiceCreate(ctx, spec, types.ServiceCreateOptions{})
+	return err
+}
+
+// fixSucceeded returns whether a fix with the given name was applied
+// successfully.
+func fixSucceeded(fixes []api.HealthcheckItem, name string) bool {
+	for _, f := range fixes {
+		if f.Name == name {
+			return f.Status == api.HealthcheckStatusOK
+		}
+	}
+	return false
+}
+
 // TODO runner option to keep containers alive instead of deleting them after
 // the test has run.
 func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.Writer) (*api.RunOutput, error) {
@@ -75,6 +346,9 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 		cfg = *input.RunnerConfig.(*ClusterSwarmRunnerConfig)
 	)
 
+	// runCtx outlives the scheduling timeout; it governs run status tracking.
+	runCtx := ctx
+
 	// global timeout of 1 minute for the scheduling.
 	ctx, cancelFn := context.WithTimeout(ctx, 1*time.Minute)
 	defer cancelFn()
@@ -100,14 +374,12 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 		TestSidecar:       true,
 	}
 
-	// Create a docker client.
-	var opts []client.Opt
-	if cfg.DockerTLS {
-		opts = append(opts, client.WithTLSClientConfig(cfg.DockerTLSCACertPath, cfg.DockerTLSCertPath, cfg.DockerTLSKeyPath))
+	if err := setLinkStats(&template, cfg.LinkStatsInterval, cfg.PublishLinkStats); err != nil {
+		return nil, err
 	}
 
-	opts = append(opts, client.WithHost(cfg.DockerEndpoint), client.WithAPIVersionNegotiation())
-	cli, err := client.NewClientWithOpts(opts...)
+	// Create a docker client.
+	cli, err := swarmClient(&cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -139,22 +411,39 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 
 	template.TestSubnet = &runtime.IPNet{IPNet: *subnet}
 
+	ipam := []network.IPAMConfig{{
+		Subnet:  subnet.String(),
+		Gateway: gateway,
+	}}
+
+	// Enabling IPv6 on an overlay network without an IPv6 subnet fails, so we
+	// only enable it on request, along with a subnet of our own.
+	if cfg.EnableIPv6 {
+		subnet6, gateway6, err := nextDataNetwork6(len(networks))
+		if err != nil {
+			return nil, err
+		}
+
+		template.TestSubnet6 = &runtime.IPNet{IPNet: *subnet6}
+		ipam = append(ipam, network.IPAMConfig{
+			Subnet:  subnet6.String(),
+			Gateway: gateway6,
+		})
+	}
+
 	// Create the data network.
-	log.Infow("creating data network", "parent", parent, "subnet", subnet)
+	log.Infow("creating data network", "parent", parent, "subnet", subnet, "ipv6", cfg.EnableIPv6)
 
 	networkSpec := types.NetworkCreate{
 		Driver:         "overlay",
 		CheckDuplicate: true,
-		// EnableIPv6:     true, // TODO(steb): this breaks.
-		Internal:   true,
-		Attachable: true,
-		Scope:      "swarm",
+		EnableIPv6:     cfg.EnableIPv6,
+		Internal:       true,
+		Attachable:     true,
+		Scope:          "swarm",
 		IPAM: &network.IPAM{
 			Driver: "default",
-			Config: []network.IPAMConfig{{
-				Subnet:  subnet.String(),
-				Gateway: gateway,
-			}},
+			Config: ipam,
 		},
 		Labels: map[string]string{
 			"testground.plan":     input.TestPlan.Name,
@@ -189,25 +478,21 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 		}
 	}()
 
-	logging.S().Infof("fetching an authorization token from AWS ECR")
-
-	// Get an authorization token from AWS ECR.
-	auth, err := aws.ECR.GetAuthToken(input.EnvConfig.AWS)
-	if err != nil {
-		return nil, err
-	}
-
-	logging.S().Infof("fetched an authorization token from AWS ECR")
-
 	services := make(map[string]int, len(input.Groups))
 	for _, g := range input.Groups {
 		runenv := template
 		runenv.TestGroupID = g.ID
+		runenv.TestNAT = g.NAT
 		runenv.TestGroupInstanceCount = g.Instances
 		runenv.TestInstanceParams = g.Parameters
 
-		// Serialize the runenv into env variables to pass to docker.
-		env := conv.ToOptionsSlice(runenv.ToEnvVars())
+		// Serialize the runenv into env variables to pass to docker. All
+		// replicas share the spec, so the index of each instance is the
+		// slot of its task, which docker fills in, and which the task that
+		// replaces it keeps.
+		m := instanceEnv(&runenv)
+		m[runtime.EnvTestGroupInstanceIndex] = "{{.Task.Slot}}"
+		env := conv.ToOptionsSlice(m)
 
 		// Set the log level if provided in cfg.
 		if cfg.LogLevel != "" {
@@ -260,11 +545,16 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 			},
 		}
 
+		auth, err := swarmRegistryAuth(input.EnvConfig, g.ArtifactPath)
+		if err != nil {
+			return nil, err
+		}
+
 		scopts := types.ServiceCreateOptions{
 			QueryRegistry: true,
 			// the registry auth will be propagated to all docker swarm nodes so
 			// they can fetch the image properly.
-			EncodedRegistryAuth: aws.ECR.EncodeAuthToken(auth),
+			EncodedRegistryAuth: auth,
 		}
 
 		logging.S().Infow("creating the service on docker swarm", "parent", parent, "group", g.ID, "image", g.ArtifactPath, "replicas", g.Instances)
@@ -285,6 +575,16 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 		return &api.RunOutput{RunID: input.RunID}, nil
 	}
 
+	// The run status published by instances on the sync service tells us how
+	// far along the run is, and the outcome of each instance.
+	statusCtx, cancelStatus := context.WithCancel(runCtx)
+	defer cancelStatus()
+
+	status, err := trackRunStatus(statusCtx, log, template, input.TotalInstances)
+	if err != nil {
+		log.Warnw("run status unavailable; tracking task states only", "err", err)
+	}
+
 	// Docker multiplexes STDOUT and STDERR streams inside the single IO stream
 	// returned by ServiceLogs. We need to use docker functions to separate
 	// those strands, and because we don't care about treating STDOUT and STDERR
@@ -376,6 +676,9 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 		log.Info("skipping removing the service due to user request")
 	}
 
+	if status != nil {
+		return &api.RunOutput{RunID: input.RunID}, status.Err()
+	}
 	return &api.RunOutput{RunID: input.RunID}, nil
 }
 
@@ -392,7 +695,7 @@ func (*ClusterSwarmRunner) ConfigType() reflect.Type {
 }
 
 func (*ClusterSwarmRunner) CompatibleBuilders() []string {
-	return []string{"docker:go"}
+	return []string{"docker:go", "docker:generic"}
 }
 
 func retry(attempts int, sleep time.Duration, f func() error) (err error) {
@@ -410,3 +713,27 @@ func retry(attempts int, sleep time.Duration, f func() error) (err error) {
 	}
 	return fmt.Errorf("after %d attempts, last error: %s", attempts, err)
 }
+
+// swarmRegistryAuth returns the encoded credentials swarm nodes pull the image
+// with: those of the generic registry if the image is hosted there, or an AWS
+// ECR authorization token otherwise.
+func swarmRegistryAuth(env config.EnvConfig, image string) (string, error) {
+	if onGenericRegistry(env, image) {
+		return docker.EncodeRegistryAuth(types.AuthConfig{
+			Username:      env.Registry.Username,
+			Password:      env.Registry.Password,
+			ServerAddress: env.Registry.Host,
+		})
+	}
+
+	logging.S().Infof("fetching an authorization token from AWS ECR")
+
+	// Get an authorization token from AWS ECR.
+	auth, err := aws.ECR.GetAuthToken(env.AWS)
+	if err != nil {
+		return "", err
+	}
+
+	logging.S().Infof("fetched an authorization token from AWS ECR")
+	return aws.ECR.EncodeAuthToken(auth), nil
+}
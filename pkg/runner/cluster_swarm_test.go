@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
+)
+
+// envEngine is an engine that only provides its environment configuration.
+type envEngine struct {
+	api.Engine
+	env config.EnvConfig
+}
+
+func (e *envEngine) EnvConfig() config.EnvConfig { return e.env }
+func (e *envEngine) Context() context.Context    { return context.Background() }
+
+func TestSwarmHealthcheckWithoutEndpoint(t *testing.T) {
+	var r ClusterSwarmRunner
+	for _, fix := range []bool{false, true} {
+		report, err := r.Healthcheck(fix, &envEngine{}, ioutil.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		check := report.Checks[0]
+		if check.Name != "swarm-api" || check.Status != api.HealthcheckStatusFailed {
+			t.Fatalf("expected the swarm-api check to fail, got %+v", check)
+		}
+		for _, c := range report.Checks[1:] {
+			if c.Status != api.HealthcheckStatusOmitted {
+				t.Errorf("expected the %s check to be omitted, got %+v", c.Name, c)
+			}
+		}
+	}
+}
@@ -1,17 +1,20 @@
 package runner
 
 import (
-	"archive/zip"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
-	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
+	"github.com/ipfs/testground/pkg/outputs"
+	"github.com/ipfs/testground/sdk/runtime"
 )
 
 // Use consistent IP address ranges for both the data and the control subnet.
@@ -36,67 +39,152 @@ func nextDataNetwork(lenNetworks int) (*net.IPNet, string, error) {
 	return subnet, gw, err
 }
 
-func zipRunOutputs(ctx context.Context, basedir string, input *api.CollectionInput, w io.Writer) error {
-	pattern := filepath.Join(basedir, "*", input.RunID)
+// nextDataNetwork6 returns the IPv6 counterpart of the data network returned
+// by nextDataNetwork for the same index: a /64 in the fd74:6700::/48 unique
+// local range.
+func nextDataNetwork6(lenNetworks int) (*net.IPNet, string, error) {
+	if lenNetworks > 4095 {
+		return nil, "", errors.New("space exhausted")
+	}
 
-	matches, err := filepath.Glob(pattern)
-	if err != nil {
-		return err
+	sn := fmt.Sprintf("fd74:6700:0:%x::/64", lenNetworks)
+	gw := fmt.Sprintf("fd74:6700:0:%x::1", lenNetworks)
+
+	_, subnet, err := net.ParseCIDR(sn)
+	return subnet, gw, err
+}
+
+// instanceEnv returns the environment variables of a test instance: its run
+// params, plus GOCOVERDIR pointing to its outputs dir, so that instances of
+// coverage builds write their coverage data there. Binaries that aren't
+// instrumented for coverage ignore it.
+func instanceEnv(runenv *runtime.RunParams) map[string]string {
+	env := runenv.ToEnvVars()
+	if runenv.TestOutputsPath != "" {
+		env["GOCOVERDIR"] = runenv.TestOutputsPath
 	}
+	return env
+}
 
-	if len(matches) != 1 {
-		return fmt.Errorf("run ID %s not found with runner %s", input.RunID, input.RunnerID)
+// setLinkStats sets the link statistics params of a runenv from the
+// link_stats_interval and publish_link_stats options of a runner.
+func setLinkStats(runenv *runtime.RunParams, interval string, publish bool) error {
+	if interval == "" {
+		return nil
 	}
 
-	dir := matches[0]
+	d, err := time.ParseDuration(interval)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid link_stats_interval %q: must be a positive duration", interval)
+	}
 
-	if fi, err := os.Stat(dir); err != nil {
-		return err
-	} else if !fi.IsDir() {
-		return fmt.Errorf("internal error: not a directory when accessing run outputs")
+	runenv.TestLinkStats = d
+	runenv.TestLinkStatsPublish = publish
+	return nil
+}
+
+// Defaults of the capture options of runners.
+const (
+	defaultCaptureSnaplen = 262144
+	defaultCaptureMaxSize = 100
+	defaultCaptureFiles   = 4
+)
+
+// setCapture sets the packet capture params of a runenv from the capture
+// options of a runner, filling in their defaults.
+func setCapture(runenv *runtime.RunParams, capture runtime.CaptureParams) error {
+	if capture.Snaplen == 0 {
+		capture.Snaplen = defaultCaptureSnaplen
+	}
+	if capture.MaxSize == 0 {
+		capture.MaxSize = defaultCaptureMaxSize
+	}
+	if capture.Files == 0 {
+		capture.Files = defaultCaptureFiles
 	}
 
-	wz := zip.NewWriter(w)
-	defer wz.Close()
-	defer wz.Flush()
+	switch {
+	case capture.Snaplen < 0:
+		return fmt.Errorf("invalid capture_snaplen %d", capture.Snaplen)
+	case capture.Files < 0:
+		return fmt.Errorf("invalid capture_files %d", capture.Files)
+	case capture.MaxSize < capture.Files:
+		return fmt.Errorf("invalid capture_max_size %d: must be at least 1 MB per file", capture.MaxSize)
+	}
 
-	base := filepath.Base(dir)
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	runenv.TestCapture = &capture
+	return nil
+}
 
-		if err := ctx.Err(); err != nil {
-			return err
-		}
+// onGenericRegistry returns whether the image is hosted on the generic
+// registry configured in the environment, i.e. whether pulling it requires
+// the credentials of that registry.
+func onGenericRegistry(env config.EnvConfig, image string) bool {
+	return env.Registry.Host != "" && strings.HasPrefix(image, env.Registry.Host+"/")
+}
 
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
-		}
+// envRunnerConfig coalesces the configuration of a runner from the
+// environment alone. It's used where no run input is at hand, such as in
+// healthchecks.
+func envRunnerConfig(env config.EnvConfig, runner string, typ reflect.Type) (interface{}, error) {
+	var cfg config.CoalescedConfig
+	cfg = cfg.Append(env.RunStrategies[runner])
+	return cfg.CoalesceIntoType(typ)
+}
 
-		header.Name = filepath.Join(base, strings.TrimPrefix(path, dir))
-		if info.IsDir() {
-			header.Name += "/"
-		} else {
-			header.Method = zip.Deflate
-		}
+// outputsStore returns the outputs store configured in the environment. If no
+// driver has been configured, outputs are stored in the runner's outputs
+// directory.
+func outputsStore(env config.EnvConfig, basedir string) (outputs.Store, error) {
+	return outputs.NewStore(env.Outputs, env.AWS, basedir)
+}
 
-		writer, err := wz.CreateHeader(header)
-		if err != nil {
-			return err
-		}
+// storeRunOutputs uploads the outputs of a run, staged under basedir, to the
+// outputs store. It's a no-op if the store is backed by basedir itself.
+func storeRunOutputs(ctx context.Context, env config.EnvConfig, basedir string, runID string) error {
+	store, err := outputsStore(env, basedir)
+	if err != nil {
+		return err
+	}
 
-		if info.IsDir() {
-			return nil
-		}
+	if fs, ok := store.(*outputs.FSStore); ok && filepath.Clean(fs.Root()) == filepath.Clean(basedir) {
+		return nil
+	}
+
+	return outputs.PutDir(ctx, store, runID, filepath.Join(basedir, runID))
+}
 
-		file, err := os.Open(path)
-		if err != nil {
-			return err
+// collectRunOutputs zips the outputs of a run from the outputs store.
+func collectRunOutputs(ctx context.Context, store outputs.Store, input *api.CollectionInput, w io.Writer) error {
+	err := outputs.Zip(ctx, store, input.RunID, w)
+	if errors.Is(err, outputs.ErrNotFound) {
+		if legacy := legacyOutputsStore(store, input.RunID); legacy != nil {
+			err = outputs.Zip(ctx, legacy, input.RunID, w)
 		}
-		defer file.Close()
-		_, err = io.Copy(writer, file)
-		return err
-	})
+	}
+	if errors.Is(err, outputs.ErrNotFound) {
+		return fmt.Errorf("run ID %s not found with runner %s", input.RunID, input.RunnerID)
+	}
+	return err
+}
+
+// legacyOutputsStore returns a store over the outputs of a run kept in the
+// layout local runners used before outputs stores, i.e. under
+// <outputs_dir>/<plan>/<run_id>, if the run is found there; nil otherwise.
+func legacyOutputsStore(store outputs.Store, runID string) outputs.Store {
+	fs, ok := store.(*outputs.FSStore)
+	if !ok {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(fs.Root(), "*", runID))
+	if err != nil || len(matches) != 1 {
+		return nil
+	}
+
+	legacy, err := outputs.NewFSStore(filepath.Dir(matches[0]))
+	if err != nil {
+		return nil
+	}
+	return legacy
 }
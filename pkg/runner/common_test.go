@@ -1,7 +1,18 @@
 package runner
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/outputs"
+	"github.com/ipfs/testground/sdk/runtime"
 )
 
 func TestNextDataNetwork(t *testing.T) {
@@ -33,3 +44,145 @@ func TestNextDataNetwork(t *testing.T) {
 		}
 	}
 }
+
+func TestNextDataNetwork6(t *testing.T) {
+	var tests = []struct {
+		lenNetworks int
+		subnet      string
+		gateway     string
+		hasError    bool
+	}{
+		{0, "fd74:6700::/64", "fd74:6700:0:0::1", false},
+		{1, "fd74:6700:0:1::/64", "fd74:6700:0:1::1", false},
+		{256, "fd74:6700:0:100::/64", "fd74:6700:0:100::1", false},
+		{4095, "fd74:6700:0:fff::/64", "fd74:6700:0:fff::1", false},
+		{4096, "", "", true},
+	}
+
+	for _, tt := range tests {
+		subnet, gateway, err := nextDataNetwork6(tt.lenNetworks)
+		if err != nil {
+			if !tt.hasError {
+				t.Errorf("got error but didn't expect one: %s", err)
+			}
+			continue
+		}
+		if tt.hasError {
+			t.Errorf("expected an error for %d networks", tt.lenNetworks)
+		}
+		if subnet.String() != tt.subnet || gateway != tt.gateway {
+			t.Errorf("got subnet %s gateway %s, want %s and %s", subnet, gateway, tt.subnet, tt.gateway)
+		}
+	}
+}
+
+func TestSetLinkStats(t *testing.T) {
+	var tests = []struct {
+		interval string
+		expected time.Duration
+		hasError bool
+	}{
+		{"", 0, false},
+		{"1s", time.Second, false},
+		{"250ms", 250 * time.Millisecond, false},
+		{"0s", 0, true},
+		{"-1s", 0, true},
+		{"often", 0, true},
+	}
+
+	for _, tt := range tests {
+		var runenv runtime.RunParams
+		err := setLinkStats(&runenv, tt.interval, true)
+		if (err != nil) != tt.hasError {
+			t.Errorf("%q: unexpected error: %v", tt.interval, err)
+			continue
+		}
+		if runenv.TestLinkStats != tt.expected {
+			t.Errorf("%q: got interval %s, want %s", tt.interval, runenv.TestLinkStats, tt.expected)
+		}
+		if runenv.TestLinkStatsPublish != (tt.expected > 0) {
+			t.Errorf("%q: unexpected publish flag %t", tt.interval, runenv.TestLinkStatsPublish)
+		}
+	}
+}
+
+func TestSetCapture(t *testing.T) {
+	var tests = []struct {
+		capture  runtime.CaptureParams
+		expected runtime.CaptureParams
+		hasError bool
+	}{
+		{
+			runtime.CaptureParams{},
+			runtime.CaptureParams{Snaplen: 262144, MaxSize: 100, Files: 4},
+			false,
+		},
+		{
+			runtime.CaptureParams{Filter: "udp", Snaplen: 96, MaxSize: 10, Files: 10},
+			runtime.CaptureParams{Filter: "udp", Snaplen: 96, MaxSize: 10, Files: 10},
+			false,
+		},
+		{runtime.CaptureParams{Snaplen: -1}, runtime.CaptureParams{}, true},
+		{runtime.CaptureParams{Files: -1}, runtime.CaptureParams{}, true},
+		{runtime.CaptureParams{MaxSize: 2, Files: 3}, runtime.CaptureParams{}, true},
+	}
+
+	for _, tt := range tests {
+		var runenv runtime.RunParams
+		err := setCapture(&runenv, tt.capture)
+		if err != nil {
+			if !tt.hasError {
+				t.Errorf("%+v: got error but didn't expect one: %s", tt.capture, err)
+			}
+			continue
+		}
+		if tt.hasError {
+			t.Errorf("%+v: expected an error", tt.capture)
+			continue
+		}
+		if *runenv.TestCapture != tt.expected {
+			t.Errorf("%+v: got %+v, want %+v", tt.capture, *runenv.TestCapture, tt.expected)
+		}
+	}
+}
+
+func TestCollectLegacyRunOutputs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// outputs of a run stored under <plan>/<run_id>, before outputs stores.
+	p := filepath.Join(tmp, "network", "abcd", "single", "0", "run.out")
+	if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte("instance 0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := outputs.NewFSStore(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	input := &api.CollectionInput{RunID: "abcd", RunnerID: "local:exec"}
+	if err := collectRunOutputs(context.Background(), store, input, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "abcd/single/0/run.out" {
+		t.Fatalf("unexpected archive entries: %v", zr.File)
+	}
+
+	input.RunID = "efgh"
+	if err := collectRunOutputs(context.Background(), store, input, &buf); err == nil {
+		t.Fatal("expected an error for an unknown run")
+	}
+}
@@ -44,14 +44,42 @@ var (
 type LocalDockerRunnerConfig struct {
 	// KeepContainers retains test containers even after they exit (default:
 	// false).
-	KeepContainers bool `toml:"keep_containers"`
+	KeepContainers bool `toml:"keep_containers" overridable:"yes"`
 	// LogLevel sets the log level in the test containers (default: not set).
-	LogLevel string `toml:"log_level"`
+	LogLevel string `toml:"log_level" overridable:"yes"`
 	// Unstarted creates the containers without starting them (default: false).
-	Unstarted bool `toml:"no_start"`
+	Unstarted bool `toml:"no_start" overridable:"yes"`
 	// Background avoids tailing the output of containers, and displaying it as
 	// log messages (default: false).
-	Background bool `toml:"background"`
+	Background bool `toml:"background" overridable:"yes"`
+	// EnableIPv6 assigns an IPv6 subnet to the data network, in addition to
+	// the IPv4 one (default: false).
+	EnableIPv6 bool `toml:"enable_ipv6" overridable:"yes"`
+
+	// LinkStatsInterval makes the sidecar sample the traffic statistics of
+	// the links of each instance at this interval, as a Go duration (e.g.
+	// "1s"), and append them to link-stats.out in its outputs (default:
+	// disabled).
+	LinkStatsInterval string `toml:"link_stats_interval" overridable:"yes"`
+	// PublishLinkStats also publishes the link statistics samples to the
+	// sync service (default: false).
+	PublishLinkStats bool `toml:"publish_link_stats" overridable:"yes"`
+
+	// Capture makes the sidecar capture the packets on the data link of each
+	// instance, into pcap files in its outputs (default: false).
+	Capture bool `toml:"capture" overridable:"yes"`
+	// CaptureFilter is the pcap filter expression of the captures (default:
+	// all packets).
+	CaptureFilter string `toml:"capture_filter" overridable:"yes"`
+	// CaptureSnaplen is the number of bytes captured per packet (default:
+	// 262144).
+	CaptureSnaplen int `toml:"capture_snaplen" overridable:"yes"`
+	// CaptureMaxSize caps the size of the capture of each instance, in MB
+	// (default: 100).
+	CaptureMaxSize int `toml:"capture_max_size" overridable:"yes"`
+	// CaptureFiles is the number of files the capture of each instance is
+	// split in, and rotates through once they're full (default: 4).
+	CaptureFiles int `toml:"capture_files" overridable:"yes"`
 }
 
 // defaultConfig is the default configuration. Incoming configurations will be
@@ -301,18 +329,37 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 		TestOutputsPath:   "/outputs",
 	}
 
+	// Merge the incoming configuration with the default configuration.
+	cfg := defaultConfig
+	if err := mergo.Merge(&cfg, input.RunnerConfig, mergo.WithOverride); err != nil {
+		return nil, fmt.Errorf("error while merging configurations: %w", err)
+	}
+
+	if err := setLinkStats(&template, cfg.LinkStatsInterval, cfg.PublishLinkStats); err != nil {
+		return nil, err
+	}
+
+	if cfg.Capture {
+		capture := runtime.CaptureParams{
+			Filter:  cfg.CaptureFilter,
+			Snaplen: cfg.CaptureSnaplen,
+			MaxSize: cfg.CaptureMaxSize,
+			Files:   cfg.CaptureFiles,
+		}
+		if err := setCapture(&template, capture); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create a data network.
-	dataNetworkID, subnet, err := newDataNetwork(ctx, cli, logging.S(), &template, "default")
+	dataNetworkID, subnet, subnet6, err := newDataNetwork(ctx, cli, logging.S(), &template, "default", cfg.EnableIPv6)
 	if err != nil {
 		return nil, err
 	}
 
 	template.TestSubnet = &runtime.IPNet{IPNet: *subnet}
-
-	// Merge the incoming configuration with the default configuration.
-	cfg := defaultConfig
-	if err := mergo.Merge(&cfg, input.RunnerConfig, mergo.WithOverride); err != nil {
-		return nil, fmt.Errorf("error while merging configurations: %w", err)
+	if subnet6 != nil {
+		template.TestSubnet6 = &runtime.IPNet{IPNet: *subnet6}
 	}
 
 	var containers []string
@@ -320,26 +367,19 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 		runenv := template
 		runenv.TestGroupInstanceCount = g.Instances
 		runenv.TestGroupID = g.ID
+		runenv.TestNAT = g.NAT
 		runenv.TestInstanceParams = g.Parameters
 
-		// Serialize the runenv into env variables to pass to docker.
-		env := conv.ToOptionsSlice(runenv.ToEnvVars())
-
-		// Set the log level if provided in cfg.
-		if cfg.LogLevel != "" {
-			env = append(env, "LOG_LEVEL="+cfg.LogLevel)
-		}
-
 		// Create the run output directory and write the runenv.
-		runDir := filepath.Join(r.outputsDir, input.TestPlan.Name, input.RunID, g.ID)
+		runDir := filepath.Join(r.outputsDir, input.RunID, g.ID)
 		if err := os.MkdirAll(runDir, 0777); err != nil {
 			return nil, err
 		}
 
 		// Start as many containers as group instances.
 		for i := 0; i < g.Instances; i++ {
-			// <outputs_dir>/<plan>/<run_id>/<group_id>/<instance_number>
-			odir := filepath.Join(r.outputsDir, input.TestPlan.Name, input.RunID, g.ID, strconv.Itoa(i))
+			// <outputs_dir>/<run_id>/<group_id>/<instance_number>
+			odir := filepath.Join(r.outputsDir, input.RunID, g.ID, strconv.Itoa(i))
 			err = os.MkdirAll(odir, 0777)
 			if err != nil {
 				err = fmt.Errorf("failed to create outputs dir %s: %w", odir, err)
@@ -349,6 +389,15 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 			name := fmt.Sprintf("tg-%s-%s-%s-%s-%d", input.TestPlan.Name, testcase.Name, input.RunID, g.ID, i)
 			log.Infow("creating container", "name", name)
 
+			// Serialize the runenv into env variables to pass to docker.
+			runenv.TestGroupInstanceIndex = i
+			env := conv.ToOptionsSlice(instanceEnv(&runenv))
+
+			// Set the log level if provided in cfg.
+			if cfg.LogLevel != "" {
+				env = append(env, "LOG_LEVEL="+cfg.LogLevel)
+			}
+
 			ccfg := &container.Config{
 				Image: g.ArtifactPath,
 				Env:   env,
@@ -459,7 +508,16 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 
 			pretty.Manage(id[0:12], rstdout, rstderr)
 		}
-		return &api.RunOutput{RunID: input.RunID}, pretty.Wait()
+
+		err := pretty.Wait()
+
+		// Outputs are only complete once all containers have finished, so we
+		// can only store them when running in the foreground.
+		if serr := storeRunOutputs(ctx, input.EnvConfig, r.outputsDir, input.RunID); serr != nil {
+			log.Errorw("failed to store run outputs", "error", serr)
+		}
+
+		return &api.RunOutput{RunID: input.RunID}, err
 	}
 
 	return &api.RunOutput{RunID: input.RunID}, nil
@@ -500,7 +558,9 @@ func ensureControlNetwork(ctx context.Context, cli *client.Client, log *zap.Suga
 	)
 }
 
-func newDataNetwork(ctx context.Context, cli *client.Client, log *zap.SugaredLogger, env *runtime.RunParams, name string) (id string, subnet *net.IPNet, err error) {
+// newDataNetwork creates a data network, with an IPv6 subnet in addition to
+// the IPv4 one if ipv6 is true.
+func newDataNetwork(ctx context.Context, cli *client.Client, log *zap.SugaredLogger, env *runtime.RunParams, name string, ipv6 bool) (id string, subnet *net.IPNet, subnet6 *net.IPNet, err error) {
 	// Find a free network.
 	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{
 		Filters: filters.NewArgs(
@@ -511,12 +571,29 @@ func newDataNetwork(ctx context.Context, cli *client.Client, log *zap.SugaredLog
 		),
 	})
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 
 	subnet, gateway, err := nextDataNetwork(len(networks))
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
+	}
+
+	ipam := []network.IPAMConfig{{
+		Subnet:  subnet.String(),
+		Gateway: gateway,
+	}}
+
+	if ipv6 {
+		var gateway6 string
+		subnet6, gateway6, err = nextDataNetwork6(len(networks))
+		if err != nil {
+			return "", nil, nil, err
+		}
+		ipam = append(ipam, network.IPAMConfig{
+			Subnet:  subnet6.String(),
+			Gateway: gateway6,
+		})
 	}
 
 	id, err = docker.NewBridgeNetwork(
@@ -530,12 +607,9 @@ func newDataNetwork(ctx context.Context, cli *client.Client, log *zap.SugaredLog
 			"testground.run_id":   env.TestRun,
 			"testground.name":     name,
 		},
-		network.IPAMConfig{
-			Subnet:  subnet.String(),
-			Gateway: gateway,
-		},
+		ipam...,
 	)
-	return id, subnet, err
+	return id, subnet, subnet6, err
 }
 
 // ensureRedisContainer ensures there's a testground-redis container started.
@@ -600,7 +674,11 @@ func ensureSidecarContainer(ctx context.Context, cli *client.Client, workDir str
 
 func (*LocalDockerRunner) CollectOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error {
 	basedir := filepath.Join(input.EnvConfig.WorkDir(), "local_docker", "outputs")
-	return zipRunOutputs(ctx, basedir, input, w)
+	store, err := outputsStore(input.EnvConfig, basedir)
+	if err != nil {
+		return err
+	}
+	return collectRunOutputs(ctx, store, input, w)
 }
 
 // attachContainerToNetwork attaches the provided container to the specified
@@ -627,5 +705,5 @@ func (*LocalDockerRunner) ConfigType() reflect.Type {
 }
 
 func (*LocalDockerRunner) CompatibleBuilders() []string {
-	return []string{"docker:go"}
+	return []string{"docker:go", "docker:generic"}
 }
@@ -137,6 +137,13 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 		return nil, fmt.Errorf("invalid sequence number %d for test %s", seq, name)
 	}
 
+	// NATs are set up by the sidecar, which this runner doesn't have.
+	for _, g := range input.Groups {
+		if g.NAT != "" && g.NAT != "none" {
+			return nil, fmt.Errorf("group %s: NAT is not supported by the local:exec runner", g.ID)
+		}
+	}
+
 	// Build a template runenv.
 	template := runtime.RunParams{
 		TestPlan:          input.TestPlan.Name,
@@ -168,7 +175,8 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 			total++
 			id := fmt.Sprintf("instance %3d", total)
 
-			odir := filepath.Join(outputsDir, input.TestPlan.Name, input.RunID, g.ID, strconv.Itoa(i))
+			// <outputs_dir>/<run_id>/<group_id>/<instance_number>
+			odir := filepath.Join(outputsDir, input.RunID, g.ID, strconv.Itoa(i))
 			if err := os.MkdirAll(odir, 0777); err != nil {
 				err = fmt.Errorf("failed to create outputs dir %s: %w", odir, err)
 				pretty.FailStart(id, err)
@@ -178,10 +186,11 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 			runenv := template
 			runenv.TestGroupID = g.ID
 			runenv.TestGroupInstanceCount = g.Instances
+			runenv.TestGroupInstanceIndex = i
 			runenv.TestInstanceParams = g.Parameters
 			runenv.TestOutputsPath = odir
 
-			env := conv.ToOptionsSlice(runenv.ToEnvVars())
+			env := conv.ToOptionsSlice(instanceEnv(&runenv))
 
 			logging.S().Infow("starting test case instance", "plan", name, "group", g.ID, "number", i, "total", total)
 
@@ -201,7 +210,13 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 		}
 	}
 
-	if err := pretty.Wait(); err != nil {
+	err := pretty.Wait()
+
+	if serr := storeRunOutputs(ctx, input.EnvConfig, outputsDir, input.RunID); serr != nil {
+		logging.S().Errorw("failed to store run outputs", "run_id", input.RunID, "error", serr)
+	}
+
+	if err != nil {
 		return nil, err
 	}
 
@@ -210,7 +225,11 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 
 func (*LocalExecutableRunner) CollectOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error {
 	basedir := filepath.Join(input.EnvConfig.WorkDir(), "local_exec", "outputs")
-	return zipRunOutputs(ctx, basedir, input, w)
+	store, err := outputsStore(input.EnvConfig, basedir)
+	if err != nil {
+		return err
+	}
+	return collectRunOutputs(ctx, store, input, w)
 }
 
 func (*LocalExecutableRunner) ID() string {
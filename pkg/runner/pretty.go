@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -46,6 +47,9 @@ type PrettyPrinter struct {
 
 	start time.Time
 	wg    sync.WaitGroup
+
+	// out is where the output goes; stdout.
+	out io.Writer
 }
 
 // NewPrettyPrinter constructs a new console logger.
@@ -66,6 +70,7 @@ func NewPrettyPrinter() *PrettyPrinter {
 			aurora.BgBrightRed("INTERNAL_ERR").White(),
 		},
 		start: time.Now(),
+		out:   os.Stdout,
 	}
 }
 
@@ -213,7 +218,7 @@ func (c *PrettyPrinter) print(idx uint32, id string, now time.Time, evtType even
 		elapsed = 0
 	}
 
-	fmt.Printf("%9.4fs %10s %s %s\n",
+	fmt.Fprintf(c.out, "%9.4fs %10s %s %s\n",
 		float64(elapsed)/float64(time.Second),
 		class,
 		c.aurora.Index(uint8(idx%15)+1, "<< "+id+" >>"),
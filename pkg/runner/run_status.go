@@ -0,0 +1,139 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/ipfs/testground/sdk/runtime"
+	"github.com/ipfs/testground/sdk/sync"
+
+	"go.uber.org/zap"
+)
+
+// runStatus tracks the progress of a run by following the lifecycle events
+// that test instances publish on the run status subtree of the sync service.
+//
+// The daemon must be able to reach the sync service (Redis), as configured by
+// the REDIS_HOST and REDIS_PORT environment variables.
+type runStatus struct {
+	log   *zap.SugaredLogger
+	total int
+	start time.Time
+
+	lk gosync.Mutex
+	// seen holds the instances that have published each type of event, as
+	// restarted instances publish their events again.
+	seen     map[sync.InstanceEventType]map[string]struct{}
+	failures []string
+
+	done chan struct{}
+}
+
+// trackRunStatus subscribes to the run status subtree of the run described by
+// the template, and tracks the lifecycle events of the specified number of
+// instances until the context fires.
+func trackRunStatus(ctx context.Context, log *zap.SugaredLogger, template runtime.RunParams, total int) (*runStatus, error) {
+	params := template
+	params.TestOutputsPath = "" // we're not an instance; don't write to the outputs dir.
+
+	wctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	watcher, err := sync.NewWatcher(wctx, runtime.NewRunEnv(params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the sync service: %w", err)
+	}
+
+	ch := make(chan *sync.InstanceEvent, 16)
+	if err := watcher.Subscribe(ctx, sync.RunStatusSubtree, ch); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("failed to subscribe to run status: %w", err)
+	}
+
+	rs := &runStatus{
+		log:   log,
+		total: total,
+		start: time.Now(),
+		seen:  make(map[sync.InstanceEventType]map[string]struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		for evt := range ch {
+			if rs.record(evt) {
+				close(rs.done)
+				return
+			}
+		}
+	}()
+
+	return rs, nil
+}
+
+// record accounts for an event, and returns true when all instances have
+// finished.
+func (rs *runStatus) record(evt *sync.InstanceEvent) bool {
+	rs.lk.Lock()
+	defer rs.lk.Unlock()
+
+	instance := evt.Instance
+
+	seen, ok := rs.seen[evt.Type]
+	if !ok {
+		seen = make(map[string]struct{})
+		rs.seen[evt.Type] = seen
+	}
+	if _, ok := seen[instance]; ok {
+		rs.log.Debugw("testplan instance status repeated", "type", evt.Type, "group", evt.GroupID, "instance", instance)
+		return false
+	}
+	seen[instance] = struct{}{}
+	n := len(seen)
+
+	switch evt.Type {
+	case sync.InstanceNetworkFailed:
+		rs.log.Warnw("testplan instance failed to initialise network", "group", evt.GroupID, "err", evt.Error)
+	case sync.InstanceFinished:
+		if evt.Outcome != runtime.EventOutcomeOK {
+			rs.failures = append(rs.failures, fmt.Sprintf("%s: %s (%s)", evt.GroupID, evt.Outcome, evt.Error))
+		}
+	}
+
+	rs.log.Debugw("testplan instance status", "type", evt.Type, "group", evt.GroupID, "count", n, "total", rs.total)
+
+	if n == rs.total {
+		switch evt.Type {
+		case sync.InstanceStarted:
+			rs.log.Infow("all testplan instances started", "took", time.Since(rs.start))
+		case sync.InstanceNetworkReady:
+			rs.log.Infow("all testplan instances networks initialised", "took", time.Since(rs.start))
+		case sync.InstanceFinished:
+			rs.log.Infow("all testplan instances finished", "took", time.Since(rs.start), "failed", len(rs.failures))
+			return true
+		}
+	}
+	return false
+}
+
+// Done returns a channel that is closed when all instances have reported
+// they've finished.
+func (rs *runStatus) Done() <-chan struct{} {
+	return rs.done
+}
+
+// Err returns an error summarising the instances that reported a non-ok
+// outcome, if any.
+func (rs *runStatus) Err() error {
+	rs.lk.Lock()
+	defer rs.lk.Unlock()
+
+	if len(rs.failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d testplan instances did not succeed: %s", len(rs.failures), strings.Join(rs.failures, "; "))
+}
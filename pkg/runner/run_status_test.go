@@ -0,0 +1,37 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/sdk/runtime"
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+func TestRunStatusCountsInstances(t *testing.T) {
+	rs := &runStatus{
+		log:   logging.S(),
+		total: 2,
+		seen:  make(map[sync.InstanceEventType]map[string]struct{}),
+		done:  make(chan struct{}),
+	}
+
+	finished := func(instance string, outcome runtime.EventOutcome) *sync.InstanceEvent {
+		return &sync.InstanceEvent{Type: sync.InstanceFinished, GroupID: "single", Instance: instance, Outcome: outcome}
+	}
+
+	if rs.record(finished("single/0", runtime.EventOutcomeCrashed)) {
+		t.Fatal("expected the run not to be done after one instance finished")
+	}
+	// a restarted instance reports it's finished again.
+	if rs.record(finished("single/0", runtime.EventOutcomeOK)) {
+		t.Fatal("expected the run not to be done after an instance finished twice")
+	}
+	if !rs.record(finished("single/1", runtime.EventOutcomeOK)) {
+		t.Fatal("expected the run to be done after all instances finished")
+	}
+
+	if err := rs.Err(); err == nil {
+		t.Fatal("expected the crashed instance to be reported")
+	}
+}
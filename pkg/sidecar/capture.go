@@ -0,0 +1,160 @@
+//+build linux
+
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ipfs/testground/sdk/runtime"
+)
+
+// captureDir is the directory, in the outputs of an instance, into which the
+// sidecar writes the packet captures of the instance.
+const captureDir = "capture"
+
+// minCaptureRun is how long a capture must have run for the sidecar to
+// restart it when it stops. Captures stop when their link is replaced, but
+// those that fail right away would fail again.
+const minCaptureRun = time.Second
+
+// capturer keeps a packet capture running on the data link of an instance,
+// if the runner asked for one, restarting it when the link is replaced (e.g.
+// when a docker network is reconnected), which stops tcpdump.
+//
+// Like the scheduler, it must only be used from the network configuration
+// loop, which receives the exit of the running capture from exited.
+type capturer struct {
+	params *runtime.CaptureParams
+	dir    string
+
+	// n is the number of captures started, which numbers their files so
+	// that a restarted capture doesn't overwrite the previous one.
+	n       int
+	started time.Time
+	exited  <-chan error
+}
+
+func newCapturer(instance *Instance) *capturer {
+	c := &capturer{params: instance.RunEnv.TestCapture}
+	if instance.OutputsPath != "" {
+		c.dir = filepath.Join(instance.OutputsPath, captureDir)
+	}
+	return c
+}
+
+// Start starts capturing on the data link, unless a capture is running
+// already. Failing to start is logged, but isn't fatal.
+func (c *capturer) Start(ctx context.Context, instance *Instance) {
+	if c.params == nil || c.exited != nil {
+		return
+	}
+	if c.dir == "" {
+		instance.S().Warnw("not capturing packets: the instance has no outputs")
+		c.params = nil
+		return
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		instance.S().Warnw("failed to create capture directory", "err", err)
+		return
+	}
+
+	path := filepath.Join(c.dir, fmt.Sprintf("default-%d.pcap", c.n))
+	exited, err := instance.Network.Capture(ctx, "default", c.params, path)
+	if err != nil {
+		instance.S().Warnw("failed to start packet capture", "err", err)
+		return
+	}
+
+	instance.S().Infow("capturing packets", "path", path, "filter", c.params.Filter)
+	c.n++
+	c.started = time.Now()
+	c.exited = exited
+}
+
+// Exited handles the exit of the running capture, restarting it if it ran
+// for long enough.
+func (c *capturer) Exited(ctx context.Context, instance *Instance, err error) {
+	c.exited = nil
+	if ctx.Err() != nil {
+		return
+	}
+
+	instance.S().Warnw("packet capture stopped", "err", err)
+	if time.Since(c.started) >= minCaptureRun {
+		c.Start(ctx, instance)
+	}
+}
+
+// captureLink captures the packets on a link, in the network namespace at
+// netnsPath, with tcpdump, until ctx is done. The returned channel receives
+// the error tcpdump exits with, if any, once it's exited.
+func captureLink(ctx context.Context, netnsPath string, ifname string, params *runtime.CaptureParams, path string) (<-chan error, error) {
+	args := append([]string{"--net=" + netnsPath, "tcpdump"}, captureArgs(ifname, params, path)...)
+	cmd := exec.Command("nsenter", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start tcpdump: %w", err)
+	}
+
+	var (
+		exited = make(chan error, 1)
+		done   = make(chan struct{})
+	)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			// let tcpdump close its files.
+			_ = cmd.Process.Signal(syscall.SIGTERM)
+		case <-done:
+		}
+	}()
+
+	go func() {
+		err := cmd.Wait()
+		close(done)
+		if err != nil && ctx.Err() == nil {
+			err = fmt.Errorf("tcpdump failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		} else {
+			err = nil
+		}
+		exited <- err
+	}()
+
+	return exited, nil
+}
+
+// captureArgs returns the tcpdump arguments of a capture. tcpdump suffixes
+// path with the index of each file of the ring.
+func captureArgs(ifname string, params *runtime.CaptureParams, path string) []string {
+	args := []string{
+		"-i", ifname,
+		"-n",
+		// write packets as they come, so that the files are usable even if
+		// tcpdump is killed.
+		"-U",
+		// don't drop privileges, to be able to write to the outputs.
+		"-Z", "root",
+		"-s", strconv.Itoa(params.Snaplen),
+		"-w", path,
+		"-C", strconv.Itoa(params.MaxSize / params.Files),
+		"-W", strconv.Itoa(params.Files),
+	}
+	if params.Filter != "" {
+		args = append(args, params.Filter)
+	}
+	return args
+}
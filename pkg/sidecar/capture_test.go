@@ -0,0 +1,31 @@
+//+build linux
+
+package sidecar
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipfs/testground/sdk/runtime"
+)
+
+func TestCaptureArgs(t *testing.T) {
+	for _, tc := range []struct {
+		params   runtime.CaptureParams
+		expected string
+	}{
+		{
+			runtime.CaptureParams{Snaplen: 262144, MaxSize: 100, Files: 4},
+			"-i eth1 -n -U -Z root -s 262144 -w /outputs/capture/default-0.pcap -C 25 -W 4",
+		},
+		{
+			runtime.CaptureParams{Filter: "udp port 4001", Snaplen: 96, MaxSize: 10, Files: 3},
+			"-i eth1 -n -U -Z root -s 96 -w /outputs/capture/default-0.pcap -C 3 -W 3 udp port 4001",
+		},
+	} {
+		args := captureArgs("eth1", &tc.params, "/outputs/capture/default-0.pcap")
+		if actual := strings.Join(args, " "); actual != tc.expected {
+			t.Errorf("%+v: expected %q, got %q", tc.params, tc.expected, actual)
+		}
+	}
+}
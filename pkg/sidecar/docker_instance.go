@@ -152,7 +152,10 @@ func (d *DockerInstanceManager) manageContainer(ctx context.Context, container *
 		return nil, nil
 	}
 
-	// Remove the TestOutputsPath. We can't store anything from the sidecar.
+	// Remove the TestOutputsPath, which is only valid within the container.
+	// The sidecar writes to the outputs of the instance through the root
+	// filesystem of its process instead.
+	outputsPath := containerPath(info.State.Pid, params.TestOutputsPath)
 	params.TestOutputsPath = ""
 	runenv := runtime.NewRunEnv(*params)
 
@@ -200,6 +203,7 @@ func (d *DockerInstanceManager) manageContainer(ctx context.Context, container *
 	// Finally, construct the network manager.
 	network := &DockerNetwork{
 		container:      container,
+		netnsPath:      fmt.Sprintf("/proc/%d/ns/net", info.State.Pid),
 		activeLinks:    make(map[string]*dockerLink, len(info.NetworkSettings.Networks)),
 		availableLinks: make(map[string]string, len(networks)),
 		nl:             netlinkHandle,
@@ -270,7 +274,7 @@ func (d *DockerInstanceManager) manageContainer(ctx context.Context, container *
 			}
 		}
 	}
-	return NewInstance(ctx, runenv, info.Config.Hostname, network)
+	return NewInstance(ctx, runenv, info.Config.Hostname, network, outputsPath)
 }
 
 type dockerLink struct {
@@ -280,6 +284,7 @@ type dockerLink struct {
 
 type DockerNetwork struct {
 	container      *dockermanager.Container
+	netnsPath      string
 	activeLinks    map[string]*dockerLink // name -> link handle
 	availableLinks map[string]string      // name -> id
 	nl             *netlink.Handle
@@ -306,6 +311,45 @@ func (dn *DockerNetwork) ListActive() []string {
 	return networks
 }
 
+func (dn *DockerNetwork) ShapeLink(ctx context.Context, network string, shape sync.LinkShape) error {
+	link, online := dn.activeLinks[network]
+	if !online {
+		return fmt.Errorf("network %s is not active", network)
+	}
+	return link.Shape(shape)
+}
+
+func (dn *DockerNetwork) Partition(ctx context.Context, network string, peers []net.IP) error {
+	link, online := dn.activeLinks[network]
+	if !online {
+		return fmt.Errorf("network %s is not active", network)
+	}
+	return partitionLink(ctx, dn.netnsPath, link.Attrs().Name, peers, link.IPv6 != nil)
+}
+
+func (dn *DockerNetwork) Addresses(network string) (ipv4, ipv6 *net.IPNet) {
+	if link, online := dn.activeLinks[network]; online {
+		return link.IPv4, link.IPv6
+	}
+	return nil, nil
+}
+
+func (dn *DockerNetwork) LinkStats(network string) (*sync.LinkStats, error) {
+	link, online := dn.activeLinks[network]
+	if !online {
+		return nil, fmt.Errorf("network %s is not active", network)
+	}
+	return linkStats(dn.netnsPath, network, link.NetlinkLink)
+}
+
+func (dn *DockerNetwork) Capture(ctx context.Context, network string, params *runtime.CaptureParams, path string) (<-chan error, error) {
+	link, online := dn.activeLinks[network]
+	if !online {
+		return nil, fmt.Errorf("network %s is not active", network)
+	}
+	return captureLink(ctx, dn.netnsPath, link.Attrs().Name, params, path)
+}
+
 func (dn *DockerNetwork) ConfigureNetwork(ctx context.Context, cfg *sync.NetworkConfig) error {
 	netId, available := dn.availableLinks[cfg.Network]
 	if !available {
@@ -327,8 +371,8 @@ func (dn *DockerNetwork) ConfigureNetwork(ctx context.Context, cfg *sync.Network
 		return nil
 	}
 
-	if online && ((cfg.IPv6 != nil && !link.IPv6.IP.Equal(cfg.IPv6.IP)) ||
-		(cfg.IPv4 != nil && !link.IPv4.IP.Equal(cfg.IPv4.IP))) {
+	if online && ((cfg.IPv6 != nil && (link.IPv6 == nil || !link.IPv6.IP.Equal(cfg.IPv6.IP))) ||
+		(cfg.IPv4 != nil && (link.IPv4 == nil || !link.IPv4.IP.Equal(cfg.IPv4.IP)))) {
 		// Disconnect and reconnect to change the IP addresses.
 		//
 		// NOTE: We probably don't need to do this on local docker.
@@ -389,13 +433,20 @@ func (dn *DockerNetwork) ConfigureNetwork(ctx context.Context, cfg *sync.Network
 		dn.activeLinks[cfg.Network] = link
 	}
 
-	// We don't yet support applying per-subnet rules.
-	if len(cfg.Rules) != 0 {
-		return fmt.Errorf("TODO: per-subnet bandwidth rules not supported")
-	}
-
 	if err := link.Shape(cfg.Default); err != nil {
 		return err
 	}
+	if err := link.SetRules(cfg.Rules); err != nil {
+		return err
+	}
+	if err := link.ShapeIngress(cfg.Ingress); err != nil {
+		return err
+	}
+	if err := filterLink(ctx, dn.netnsPath, link.Attrs().Name, cfg.Default.Filter, cfg.Rules, link.IPv6 != nil); err != nil {
+		return err
+	}
+	if err := natLink(ctx, dn.netnsPath, link.NetlinkLink, link.IPv4, cfg.NAT); err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,157 @@
+//+build linux
+
+package sidecar
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+// filterLink enforces the FilterAction of the default shape and of the
+// per-subnet rules of a link, in the network namespace at netnsPath.
+//
+// Filters are implemented with iptables, as tc can't reject traffic. Each link
+// gets two chains, one for inbound and one for outbound traffic, which are
+// jumped to from the INPUT and OUTPUT chains for traffic on the link only, so
+// that the control network is never filtered. Both chains are rebuilt from
+// scratch every time the link is configured.
+//
+// Rules on IPv6 subnets are enforced with ip6tables, which is only used if
+// there are such rules, or if the link has an IPv6 address (ipv6), in which
+// case the default action applies to IPv6 traffic too.
+func filterLink(ctx context.Context, netnsPath string, ifname string, def sync.FilterAction, rules []sync.LinkRule, ipv6 bool) error {
+	var rules4, rules6 []sync.LinkRule
+	for _, r := range rules {
+		if r.Subnet.IP.To4() != nil {
+			rules4 = append(rules4, r)
+		} else {
+			rules6 = append(rules6, r)
+		}
+	}
+
+	if err := runIptables(ctx, netnsPath, "iptables", filterCommands(ifname, def, rules4, false)); err != nil {
+		return err
+	}
+	if !ipv6 && len(rules6) == 0 {
+		return nil
+	}
+	return runIptables(ctx, netnsPath, "ip6tables", filterCommands(ifname, def, rules6, true))
+}
+
+// runIptables runs the commands with the given iptables binary.
+func runIptables(ctx context.Context, netnsPath string, bin string, cmds []iptablesCmd) error {
+	for _, c := range cmds {
+		if c.unless != nil && iptables(ctx, netnsPath, bin, c.unless...) == nil {
+			continue
+		}
+		if err := iptables(ctx, netnsPath, bin, c.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iptablesCmd is an iptables command.
+type iptablesCmd struct {
+	// unless is a command that, if it succeeds, makes this one unnecessary.
+	unless []string
+	args   []string
+}
+
+// filterChains returns the names of the inbound and outbound chains of a link.
+func filterChains(ifname string) (in, out string) {
+	return "tg-in-" + ifname, "tg-out-" + ifname
+}
+
+// chainCommands returns the iptables commands that create the inbound and
+// outbound chains of a link, if they don't exist yet, flush them, and jump to
+// them for the traffic on the link.
+func chainCommands(ifname string, in, out string) []iptablesCmd {
+	return []iptablesCmd{
+		{unless: []string{"-n", "-L", in}, args: []string{"-N", in}},
+		{unless: []string{"-n", "-L", out}, args: []string{"-N", out}},
+		{args: []string{"-F", in}},
+		{args: []string{"-F", out}},
+		{
+			unless: []string{"-C", "INPUT", "-i", ifname, "-j", in},
+			args:   []string{"-I", "INPUT", "-i", ifname, "-j", in},
+		},
+		{
+			unless: []string{"-C", "OUTPUT", "-o", ifname, "-j", out},
+			args:   []string{"-I", "OUTPUT", "-o", ifname, "-j", out},
+		},
+	}
+}
+
+// filterCommands returns the iptables commands that set up the filters of a
+// link, for IPv6 traffic (ip6tables) if v6 is true, and IPv4 traffic otherwise.
+func filterCommands(ifname string, def sync.FilterAction, rules []sync.LinkRule, v6 bool) []iptablesCmd {
+	in, out := filterChains(ifname)
+	cmds := chainCommands(ifname, in, out)
+
+	// Unless something is filtered, there's nothing else to do.
+	filtered := def != sync.Accept
+	for _, r := range rules {
+		filtered = filtered || r.Filter != sync.Accept
+	}
+	if !filtered {
+		return cmds
+	}
+
+	// The most specific subnets go first, so they take precedence; the default
+	// action applies to whatever they don't match.
+	for _, r := range sortRules(rules) {
+		subnet := r.Subnet.String()
+		cmds = append(cmds, filterTargets(in, []string{"-s", subnet}, r.Filter, v6)...)
+		cmds = append(cmds, filterTargets(out, []string{"-d", subnet}, r.Filter, v6)...)
+	}
+	if def != sync.Accept {
+		cmds = append(cmds, filterTargets(in, nil, def, v6)...)
+		cmds = append(cmds, filterTargets(out, nil, def, v6)...)
+	}
+
+	return cmds
+}
+
+// filterTargets returns the commands appending the rules that apply action to
+// the traffic matching match, to chain.
+func filterTargets(chain string, match []string, action sync.FilterAction, v6 bool) []iptablesCmd {
+	rule := func(extra ...string) iptablesCmd {
+		args := append([]string{"-A", chain}, match...)
+		return iptablesCmd{args: append(args, extra...)}
+	}
+
+	switch action {
+	case sync.Drop:
+		return []iptablesCmd{rule("-j", "DROP")}
+	case sync.Reject:
+		// reset TCP connections, and reply with ICMP port unreachable to
+		// anything else.
+		unreachable := "icmp-port-unreachable"
+		if v6 {
+			unreachable = "icmp6-port-unreachable"
+		}
+		return []iptablesCmd{
+			rule("-p", "tcp", "-j", "REJECT", "--reject-with", "tcp-reset"),
+			rule("-j", "REJECT", "--reject-with", unreachable),
+		}
+	default:
+		// return rather than accept, so that the chains jumped to after
+		// this one (e.g. partitions) still apply.
+		return []iptablesCmd{rule("-j", "RETURN")}
+	}
+}
+
+// iptables runs an iptables command with the given binary (iptables or
+// ip6tables) in the network namespace at netnsPath.
+func iptables(ctx context.Context, netnsPath string, bin string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "nsenter", append([]string{"--net=" + netnsPath, bin, "-w"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", bin, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
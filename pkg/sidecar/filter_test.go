@@ -0,0 +1,94 @@
+//+build linux
+
+package sidecar
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+// appended returns the rules appended by the commands, as strings.
+func appended(cmds []iptablesCmd) []string {
+	var out []string
+	for _, c := range cmds {
+		if c.args[0] == "-A" {
+			out = append(out, strings.Join(c.args[1:], " "))
+		}
+	}
+	return out
+}
+
+func TestFilterCommandsAccept(t *testing.T) {
+	cmds := filterCommands("eth1", sync.Accept, []sync.LinkRule{
+		{Subnet: mustParseCIDR(t, "16.1.0.0/16")},
+	}, false)
+
+	// chains are still set up and flushed, so that previous filters go away.
+	if len(cmds) == 0 {
+		t.Fatal("expected the chains to be set up")
+	}
+	if rules := appended(cmds); len(rules) != 0 {
+		t.Fatalf("expected no filtering rules, got %v", rules)
+	}
+}
+
+func TestFilterCommands(t *testing.T) {
+	var (
+		drop   = sync.LinkRule{Subnet: mustParseCIDR(t, "16.1.0.0/16"), LinkShape: sync.LinkShape{Filter: sync.Drop}}
+		accept = sync.LinkRule{Subnet: mustParseCIDR(t, "16.1.2.0/24")}
+	)
+
+	cmds := filterCommands("eth1", sync.Reject, []sync.LinkRule{drop, accept}, false)
+
+	expected := []string{
+		"tg-in-eth1 -s 16.1.2.0/24 -j RETURN",
+		"tg-out-eth1 -d 16.1.2.0/24 -j RETURN",
+		"tg-in-eth1 -s 16.1.0.0/16 -j DROP",
+		"tg-out-eth1 -d 16.1.0.0/16 -j DROP",
+		"tg-in-eth1 -p tcp -j REJECT --reject-with tcp-reset",
+		"tg-in-eth1 -j REJECT --reject-with icmp-port-unreachable",
+		"tg-out-eth1 -p tcp -j REJECT --reject-with tcp-reset",
+		"tg-out-eth1 -j REJECT --reject-with icmp-port-unreachable",
+	}
+
+	rules := appended(cmds)
+	if strings.Join(rules, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected rules:\n%s\nexpected:\n%s", strings.Join(rules, "\n"), strings.Join(expected, "\n"))
+	}
+
+	// only traffic on the link is filtered.
+	var jumps int
+	for _, c := range cmds {
+		if c.args[0] == "-I" {
+			jumps++
+			if !strings.Contains(strings.Join(c.args, " "), "eth1 -j tg-") {
+				t.Errorf("unexpected jump: %v", c.args)
+			}
+		}
+	}
+	if jumps != 2 {
+		t.Fatalf("expected 2 jumps, got %d", jumps)
+	}
+}
+
+func TestFilterCommandsIPv6(t *testing.T) {
+	drop := sync.LinkRule{Subnet: mustParseCIDR(t, "fd74:6700:0:1::/64"), LinkShape: sync.LinkShape{Filter: sync.Drop}}
+
+	cmds := filterCommands("eth1", sync.Reject, []sync.LinkRule{drop}, true)
+
+	expected := []string{
+		"tg-in-eth1 -s fd74:6700:0:1::/64 -j DROP",
+		"tg-out-eth1 -d fd74:6700:0:1::/64 -j DROP",
+		"tg-in-eth1 -p tcp -j REJECT --reject-with tcp-reset",
+		"tg-in-eth1 -j REJECT --reject-with icmp6-port-unreachable",
+		"tg-out-eth1 -p tcp -j REJECT --reject-with tcp-reset",
+		"tg-out-eth1 -j REJECT --reject-with icmp6-port-unreachable",
+	}
+
+	rules := appended(cmds)
+	if strings.Join(rules, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected rules:\n%s\nexpected:\n%s", strings.Join(rules, "\n"), strings.Join(expected, "\n"))
+	}
+}
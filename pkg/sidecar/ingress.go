@@ -0,0 +1,101 @@
+//+build linux
+
+package sidecar
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+var ingressHandle = netlink.MakeHandle(0xffff, 0)
+
+// ShapeIngress applies the link "shape" to the inbound traffic of the link.
+//
+// TC can only shape egress traffic, so inbound traffic is redirected to an IFB
+// (intermediate functional block) device, and shaped on its egress by a
+// NetlinkLink of its own, with the same TC tree. The IFB device is only set up
+// the first time ingress is shaped; a nil shape lifts the ingress shaping, if
+// any.
+func (l *NetlinkLink) ShapeIngress(shape *sync.LinkShape) error {
+	if shape == nil {
+		if l.ingress == nil {
+			return nil
+		}
+		return l.ingress.Shape(sync.LinkShape{})
+	}
+
+	if l.ingress == nil {
+		ingress, err := l.setupIngress()
+		if err != nil {
+			return fmt.Errorf("failed to set up ingress shaping: %w", err)
+		}
+		l.ingress = ingress
+	}
+	return l.ingress.Shape(*shape)
+}
+
+// ifbName returns the name of the IFB device of a link, within the limits of
+// interface names.
+func ifbName(ifname string) string {
+	name := "ifb-" + ifname
+	if len(name) > unix.IFNAMSIZ-1 {
+		name = name[:unix.IFNAMSIZ-1]
+	}
+	return name
+}
+
+// setupIngress creates the IFB device of the link, and redirects all the
+// inbound traffic of the link to it.
+func (l *NetlinkLink) setupIngress() (*NetlinkLink, error) {
+	name := ifbName(l.Attrs().Name)
+
+	// a previous incarnation of this link (e.g. before a docker network was
+	// reconnected) may have left its IFB device behind.
+	if stale, err := l.handle.LinkByName(name); err == nil {
+		if err := l.handle.LinkDel(stale); err != nil {
+			return nil, fmt.Errorf("failed to remove stale ifb device: %w", err)
+		}
+	}
+
+	if err := l.handle.LinkAdd(&netlink.Ifb{LinkAttrs: netlink.LinkAttrs{Name: name}}); err != nil {
+		return nil, fmt.Errorf("failed to create ifb device: %w", err)
+	}
+
+	ifb, err := l.handle.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ifb device: %w", err)
+	}
+
+	if err := l.handle.LinkSetUp(ifb); err != nil {
+		return nil, fmt.Errorf("failed to set ifb device up: %w", err)
+	}
+
+	if err := l.handle.QdiscAdd(&netlink.Ingress{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: l.Attrs().Index,
+			Parent:    netlink.HANDLE_INGRESS,
+			Handle:    ingressHandle,
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to set ingress qdisc: %w", err)
+	}
+
+	// a u32 filter without a selector matches all packets.
+	if err := l.handle.FilterAdd(&netlink.U32{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: l.Attrs().Index,
+			Parent:    ingressHandle,
+			Priority:  1,
+			Protocol:  unix.ETH_P_ALL,
+		},
+		RedirIndex: ifb.Attrs().Index,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to redirect ingress traffic: %w", err)
+	}
+
+	return NewNetlinkLink(l.handle, ifb)
+}
@@ -0,0 +1,55 @@
+//+build linux
+
+package sidecar
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+func TestIfbName(t *testing.T) {
+	if n := ifbName("eth1"); n != "ifb-eth1" {
+		t.Fatalf("unexpected name: %s", n)
+	}
+	if n := ifbName("a-very-long-ifname"); len(n) != unix.IFNAMSIZ-1 {
+		t.Fatalf("expected name to be truncated, got %s", n)
+	}
+}
+
+func TestShapeIngress(t *testing.T) {
+	l, cleanup := testLink(t)
+	defer cleanup()
+
+	// lifting ingress shaping that was never set up is a no-op.
+	if err := l.ShapeIngress(nil); err != nil {
+		t.Fatal(err)
+	}
+	if l.ingress != nil {
+		t.Fatal("expected no ifb device to be set up")
+	}
+
+	err := l.ShapeIngress(&sync.LinkShape{Latency: 10 * time.Millisecond})
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOENT) {
+		t.Skipf("the kernel doesn't support ifb devices: %s", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters, err := l.handle.FilterList(l.Link, ingressHandle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 1 {
+		t.Fatalf("expected a single redirect filter, got %d", len(filters))
+	}
+
+	if err := l.ShapeIngress(nil); err != nil {
+		t.Fatal(err)
+	}
+}
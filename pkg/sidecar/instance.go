@@ -6,6 +6,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
+	"path/filepath"
 
 	"github.com/hashicorp/go-multierror"
 
@@ -23,6 +25,10 @@ type Instance struct {
 	Writer   *sync.Writer
 	RunEnv   *runtime.RunEnv
 	Network  Network
+
+	// OutputsPath is the path at which the sidecar can write to the outputs
+	// directory of the instance, if it has one.
+	OutputsPath string
 }
 
 // Network is a test instance's network, as seen by the sidecar.
@@ -31,6 +37,21 @@ type Instance struct {
 type Network interface {
 	io.Closer
 	ConfigureNetwork(ctx context.Context, cfg *sync.NetworkConfig) error
+	// ShapeLink changes the default link shape of an active network, leaving
+	// the rest of its configuration alone.
+	ShapeLink(ctx context.Context, network string, shape sync.LinkShape) error
+	// Partition drops all the traffic to and from peers on an active network,
+	// replacing the peers previously dropped.
+	Partition(ctx context.Context, network string, peers []net.IP) error
+	// Addresses returns the addresses of an active network, if any.
+	Addresses(network string) (ipv4, ipv6 *net.IPNet)
+	// LinkStats samples the traffic statistics of the link of an active
+	// network.
+	LinkStats(network string) (*sync.LinkStats, error)
+	// Capture captures the packets on the link of an active network into
+	// files named after path, until ctx is done. The returned channel
+	// receives the error the capture stopped with, if any, once it's stopped.
+	Capture(ctx context.Context, network string, params *runtime.CaptureParams, path string) (<-chan error, error)
 	ListActive() []string
 }
 
@@ -42,7 +63,7 @@ type Logs interface {
 }
 
 // NewInstance constructs a new test instance handle.
-func NewInstance(ctx context.Context, runenv *runtime.RunEnv, hostname string, network Network) (*Instance, error) {
+func NewInstance(ctx context.Context, runenv *runtime.RunEnv, hostname string, network Network, outputsPath string) (*Instance, error) {
 	// Get a redis reader/writer.
 	watcher, writer, err := sync.WatcherWriter(ctx, runenv)
 	if err != nil {
@@ -56,9 +77,21 @@ func NewInstance(ctx context.Context, runenv *runtime.RunEnv, hostname string, n
 		Network:  network,
 		Watcher:  watcher,
 		Writer:   writer,
+
+		OutputsPath: outputsPath,
 	}, nil
 }
 
+// containerPath returns the path at which the sidecar, which shares the PID
+// namespace of the host, can reach a path in the filesystem of the container
+// whose process is pid. It returns an empty path if path is empty.
+func containerPath(pid int, path string) string {
+	if path == "" {
+		return ""
+	}
+	return filepath.Join(fmt.Sprintf("/proc/%d/root", pid), path)
+}
+
 // Close closes the instance. It should not be used after closing.
 func (inst *Instance) Close() error {
 	var err *multierror.Error
@@ -111,7 +111,10 @@ func (d *K8sInstanceManager) manageContainer(ctx context.Context, container *doc
 		return nil, nil
 	}
 
-	// Remove the TestOutputsPath. We can't store anything from the sidecar.
+	// Remove the TestOutputsPath, which is only valid within the container.
+	// The sidecar writes to the outputs of the instance through the root
+	// filesystem of its process instead.
+	outputsPath := containerPath(info.State.Pid, params.TestOutputsPath)
 	params.TestOutputsPath = ""
 	runenv := runtime.NewRunEnv(*params)
 
@@ -244,7 +247,7 @@ func (d *K8sInstanceManager) manageContainer(ctx context.Context, container *doc
 		}
 	}
 
-	return NewInstance(ctx, runenv, info.Config.Hostname, network)
+	return NewInstance(ctx, runenv, info.Config.Hostname, network, outputsPath)
 }
 
 type k8sLink struct {
@@ -269,6 +272,51 @@ func (n *K8sNetwork) Close() error {
 	return nil
 }
 
+func (n *K8sNetwork) ShapeLink(ctx context.Context, network string, shape sync.LinkShape) error {
+	link, online := n.activeLinks[network]
+	if !online {
+		return fmt.Errorf("network %s is not active", network)
+	}
+	if err := link.Shape(shape); err != nil {
+		return fmt.Errorf("failed to shape link: %w", err)
+	}
+	return nil
+}
+
+func (n *K8sNetwork) Partition(ctx context.Context, network string, peers []net.IP) error {
+	link, online := n.activeLinks[network]
+	if !online {
+		return fmt.Errorf("network %s is not active", network)
+	}
+	if err := partitionLink(ctx, n.netnsPath, link.Attrs().Name, peers, false); err != nil {
+		return fmt.Errorf("failed to partition link: %w", err)
+	}
+	return nil
+}
+
+func (n *K8sNetwork) Addresses(network string) (ipv4, ipv6 *net.IPNet) {
+	if link, online := n.activeLinks[network]; online {
+		return link.IPv4, link.IPv6
+	}
+	return nil, nil
+}
+
+func (n *K8sNetwork) LinkStats(network string) (*sync.LinkStats, error) {
+	link, online := n.activeLinks[network]
+	if !online {
+		return nil, fmt.Errorf("network %s is not active", network)
+	}
+	return linkStats(n.netnsPath, network, link.NetlinkLink)
+}
+
+func (n *K8sNetwork) Capture(ctx context.Context, network string, params *runtime.CaptureParams, path string) (<-chan error, error) {
+	link, online := n.activeLinks[network]
+	if !online {
+		return nil, fmt.Errorf("network %s is not active", network)
+	}
+	return captureLink(ctx, n.netnsPath, link.Attrs().Name, params, path)
+}
+
 func (n *K8sNetwork) ConfigureNetwork(ctx context.Context, cfg *sync.NetworkConfig) error {
 	if cfg.Network != "default" {
 		return errors.New("configured network is not default")
@@ -289,8 +337,8 @@ func (n *K8sNetwork) ConfigureNetwork(ctx context.Context, cfg *sync.NetworkConf
 		return nil
 	}
 
-	if online && ((cfg.IPv6 != nil && !link.IPv6.IP.Equal(cfg.IPv6.IP)) ||
-		(cfg.IPv4 != nil && !link.IPv4.IP.Equal(cfg.IPv4.IP))) {
+	if online && ((cfg.IPv6 != nil && (link.IPv6 == nil || !link.IPv6.IP.Equal(cfg.IPv6.IP))) ||
+		(cfg.IPv4 != nil && (link.IPv4 == nil || !link.IPv4.IP.Equal(cfg.IPv4.IP)))) {
 		// Disconnect and reconnect to change the IP addresses.
 		logging.S().Debugw("disconnect and reconnect to change the IP addr", "cfg.IPv4", cfg.IPv4, "link.IPv4", link.IPv4.String(), "container", n.container.ID)
 		//
@@ -371,14 +419,21 @@ func (n *K8sNetwork) ConfigureNetwork(ctx context.Context, cfg *sync.NetworkConf
 		n.activeLinks[cfg.Network] = link
 	}
 
-	// We don't yet support applying per-subnet rules.
-	if len(cfg.Rules) != 0 {
-		return fmt.Errorf("TODO: per-subnet bandwidth rules not supported")
-	}
-
 	if err := link.Shape(cfg.Default); err != nil {
 		return fmt.Errorf("failed to shape link: %w", err)
 	}
+	if err := link.SetRules(cfg.Rules); err != nil {
+		return fmt.Errorf("failed to apply link rules: %w", err)
+	}
+	if err := link.ShapeIngress(cfg.Ingress); err != nil {
+		return fmt.Errorf("failed to shape ingress: %w", err)
+	}
+	if err := filterLink(ctx, n.netnsPath, link.Attrs().Name, cfg.Default.Filter, cfg.Rules, false); err != nil {
+		return fmt.Errorf("failed to filter link: %w", err)
+	}
+	if err := natLink(ctx, n.netnsPath, link.NetlinkLink, link.IPv4, cfg.NAT); err != nil {
+		return fmt.Errorf("failed to set up NAT: %w", err)
+	}
 	return nil
 }
 
@@ -3,12 +3,15 @@
 package sidecar
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"net"
+	"sort"
 	"time"
 
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 
 	"github.com/ipfs/testground/sdk/sync"
 )
@@ -20,8 +23,9 @@ var (
 
 // NetlinkLink abstracts operations over a network interface.
 //
-// NetlinkLink shapes the egress traffic on the link using TC. To do so, it
-// configures the following TC tree:
+// NetlinkLink shapes the egress traffic on the link using TC, and optionally the
+// ingress traffic (see ShapeIngress). To do so, it configures the following TC
+// tree:
 //
 //     [________HTB Qdisc_________] - root
 //        0 |      1 |     n | ...  - queue; 0 is the default.
@@ -29,8 +33,9 @@ var (
 //          |
 //     [Netem Qdisc]                - latency, jitter, etc. (per-packet attributes)
 //
-// At the moment, only one queue is supported. When support for multiple subnets
-// is added, additional classes/queues will be added per-subnet.
+// Queue 0 shapes the traffic by default. Each per-subnet LinkRule gets its own
+// queue (1..n), and a u32 filter on the root qdisc steers the traffic destined
+// to the rule's subnet into it.
 //
 // NetlinkLink also supports setting the network device up/down and changing the
 // IP address.
@@ -40,6 +45,14 @@ var (
 type NetlinkLink struct {
 	netlink.Link
 	handle *netlink.Handle
+
+	// rules is the number of per-subnet queues currently set up, after the
+	// default one.
+	rules int
+
+	// ingress shapes the inbound traffic of the link, once ingress shaping
+	// has been requested. See ShapeIngress.
+	ingress *NetlinkLink
 }
 
 // NewNetlinkLink constructs a new netlink link handle.
@@ -74,11 +87,10 @@ func handlesForIndex(idx uint16) (htb, netem uint32) {
 	return netlink.MakeHandle(1, id), netlink.MakeHandle(id, 0)
 }
 
-// Initialize the class with index `idx`. For now, we only init a single
-// (default) class. In the future, we'll create one per network. On _each_
-// interface.
+// Initialize the class with index `idx`: 0 is the default class, and each
+// per-subnet rule gets its own class after it.
 //
-// We can then specify egress propreties per-network by mapping traffic to each
+// We can then specify egress propreties per-subnet by mapping traffic to each
 // of these classes using filters.
 func (l *NetlinkLink) init(idx uint16) error {
 	htbHandle, netemHandle := handlesForIndex(idx)
@@ -152,20 +164,23 @@ func toMicroseconds(t time.Duration) uint32 {
 // Shape applies the link "shape" to the link, setting the bandwidth, latency,
 // jitter, etc.
 func (l *NetlinkLink) Shape(shape sync.LinkShape) error {
+	return l.shapeClass(0, shape)
+}
+
+// shapeClass applies the link "shape" to the class with index `idx`.
+func (l *NetlinkLink) shapeClass(idx uint16, shape sync.LinkShape) error {
 	rate := shape.Bandwidth
 	if rate == 0 {
 		rate = math.MaxUint64
 	}
 
-	// TODO: eventually, we'll have a queue per-subnet to allow shaping per-subnet.
-
-	if err := l.setHtb(0, netlink.HtbClassAttrs{
+	if err := l.setHtb(idx, netlink.HtbClassAttrs{
 		Rate: rate,
 	}); err != nil {
 		return err
 	}
 
-	if err := l.setNetem(0, netlink.NetemQdiscAttrs{
+	if err := l.setNetem(idx, netlink.NetemQdiscAttrs{
 		Jitter:        toMicroseconds(shape.Jitter),
 		Latency:       toMicroseconds(shape.Latency),
 		Loss:          shape.Loss,
@@ -181,6 +196,157 @@ func (l *NetlinkLink) Shape(shape sync.LinkShape) error {
 	return nil
 }
 
+// SetRules replaces the per-subnet rules of the link. Traffic destined to the
+// subnet of a rule is shaped by that rule instead of the default shape. When
+// subnets overlap, the most specific one wins.
+func (l *NetlinkLink) SetRules(rules []sync.LinkRule) error {
+	rules = sortRules(rules)
+
+	var (
+		sels   = make([]*netlink.TcU32Sel, len(rules))
+		protos = make([]uint16, len(rules))
+	)
+	for i, r := range rules {
+		sel, proto, err := subnetSelector(r.Subnet)
+		if err != nil {
+			return err
+		}
+		sels[i], protos[i] = sel, proto
+	}
+
+	// Remove the filters of the previous rules first, so that no traffic is
+	// steered into a class while we reshape it.
+	if err := l.clearFilters(); err != nil {
+		return err
+	}
+
+	// Set up the classes we're missing, and tear down those we no longer need.
+	for idx := l.rules + 1; idx <= len(rules); idx++ {
+		if err := l.init(uint16(idx)); err != nil {
+			return err
+		}
+		l.rules = idx
+	}
+	for idx := l.rules; idx > len(rules); idx-- {
+		if err := l.remove(uint16(idx)); err != nil {
+			return err
+		}
+		l.rules = idx - 1
+	}
+
+	for i, r := range rules {
+		idx := uint16(i + 1)
+		if err := l.shapeClass(idx, r.LinkShape); err != nil {
+			return fmt.Errorf("failed to shape traffic to %s: %w", r.Subnet.String(), err)
+		}
+
+		htbHandle, _ := handlesForIndex(idx)
+		if err := l.handle.FilterAdd(&netlink.U32{
+			FilterAttrs: netlink.FilterAttrs{
+				LinkIndex: l.Attrs().Index,
+				Parent:    rootHandle,
+				Priority:  idx,
+				Protocol:  protos[i],
+			},
+			ClassId: htbHandle,
+			Sel:     sels[i],
+		}); err != nil {
+			return fmt.Errorf("failed to add filter for %s: %w", r.Subnet.String(), err)
+		}
+	}
+
+	return nil
+}
+
+// clearFilters removes all filters from the root qdisc. Filters are deleted
+// by priority, which removes the hash tables the kernel creates for u32
+// filters along with them.
+func (l *NetlinkLink) clearFilters() error {
+	filters, err := l.handle.FilterList(l.Link, rootHandle)
+	if err != nil {
+		return fmt.Errorf("failed to list filters: %w", err)
+	}
+
+	deleted := make(map[netlink.FilterAttrs]bool, len(filters))
+	for _, f := range filters {
+		attrs := netlink.FilterAttrs{
+			LinkIndex: l.Attrs().Index,
+			Parent:    rootHandle,
+			Priority:  f.Attrs().Priority,
+			Protocol:  f.Attrs().Protocol,
+		}
+		if deleted[attrs] {
+			continue
+		}
+		if err := l.handle.FilterDel(&netlink.U32{FilterAttrs: attrs}); err != nil {
+			return fmt.Errorf("failed to remove filter: %w", err)
+		}
+		deleted[attrs] = true
+	}
+	return nil
+}
+
+// remove tears down the class with index `idx`, along with its netem qdisc.
+func (l *NetlinkLink) remove(idx uint16) error {
+	htbHandle, _ := handlesForIndex(idx)
+	err := l.handle.ClassDel(netlink.NewHtbClass(
+		netlink.ClassAttrs{
+			LinkIndex: l.Attrs().Index,
+			Parent:    rootHandle,
+			Handle:    htbHandle,
+		},
+		netlink.HtbClassAttrs{},
+	))
+	if err != nil {
+		return fmt.Errorf("failed to remove htb class: %w", err)
+	}
+	return nil
+}
+
+// sortRules returns the rules sorted from the most to the least specific
+// subnet, so that filters match the most specific subnet first.
+func sortRules(rules []sync.LinkRule) []sync.LinkRule {
+	sorted := append([]sync.LinkRule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		oi, _ := sorted[i].Subnet.Mask.Size()
+		oj, _ := sorted[j].Subnet.Mask.Size()
+		return oi > oj
+	})
+	return sorted
+}
+
+// subnetSelector returns the u32 selector matching IP packets destined to the
+// subnet, along with the ethernet protocol of those packets.
+func subnetSelector(subnet net.IPNet) (*netlink.TcU32Sel, uint16, error) {
+	var (
+		ip    = subnet.IP.To4()
+		proto = uint16(unix.ETH_P_IP)
+		off   = int32(16) // destination address in the IPv4 header.
+	)
+	if ip == nil || len(subnet.Mask) != net.IPv4len {
+		ip, proto, off = subnet.IP.To16(), unix.ETH_P_IPV6, 24 // in the IPv6 header.
+	}
+	if ip == nil || len(subnet.Mask) != len(ip) {
+		return nil, 0, fmt.Errorf("unsupported subnet %s", subnet.String())
+	}
+
+	// match the address 32 bits at a time, skipping the words the mask
+	// ignores entirely; u32 needs at least one key though.
+	sel := &netlink.TcU32Sel{Flags: netlink.TC_U32_TERMINAL}
+	for i := 0; i < len(ip); i += 4 {
+		mask := binary.BigEndian.Uint32(subnet.Mask[i:])
+		if mask == 0 && i > 0 {
+			break
+		}
+		sel.Keys = append(sel.Keys, netlink.TcU32Key{
+			Mask: mask,
+			Val:  binary.BigEndian.Uint32(ip[i:]) & mask,
+			Off:  off + int32(i),
+		})
+	}
+	return sel, proto, nil
+}
+
 // NOTE: None of the following methods are currently used. They exist for future
 // non-docker runners.
 
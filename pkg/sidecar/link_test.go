@@ -0,0 +1,198 @@
+//+build linux
+
+package sidecar
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+func mustParseCIDR(t *testing.T, s string) net.IPNet {
+	t.Helper()
+
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *n
+}
+
+// testLink returns the loopback link of a scratch network namespace, skipping
+// the test if we're not allowed to create one.
+func testLink(t *testing.T) (*NetlinkLink, func()) {
+	t.Helper()
+
+	// network namespaces are per-thread.
+	runtime.LockOSThread()
+
+	orig, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ns, err := netns.New()
+	if err != nil {
+		runtime.UnlockOSThread()
+		t.Skipf("unable to create a network namespace: %s", err)
+	}
+
+	cleanup := func() {
+		_ = netns.Set(orig)
+		ns.Close()
+		orig.Close()
+		runtime.UnlockOSThread()
+	}
+
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	link, err := handle.LinkByName("lo")
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	l, err := NewNetlinkLink(handle, link)
+	if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.EOPNOTSUPP) {
+		cleanup()
+		t.Skipf("the kernel doesn't support the required qdiscs: %s", err)
+	}
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return l, func() {
+		handle.Delete()
+		cleanup()
+	}
+}
+
+func TestSortRules(t *testing.T) {
+	rules := []sync.LinkRule{
+		{Subnet: mustParseCIDR(t, "16.0.0.0/8")},
+		{Subnet: mustParseCIDR(t, "16.1.0.0/16")},
+		{Subnet: mustParseCIDR(t, "16.1.2.0/24")},
+		{Subnet: mustParseCIDR(t, "17.1.0.0/16")},
+	}
+
+	sorted := sortRules(rules)
+
+	expected := []string{"16.1.2.0/24", "16.1.0.0/16", "17.1.0.0/16", "16.0.0.0/8"}
+	for i, r := range sorted {
+		if r.Subnet.String() != expected[i] {
+			t.Fatalf("expected rule %d to be %s, got %s", i, expected[i], r.Subnet.String())
+		}
+	}
+
+	if rules[0].Subnet.String() != "16.0.0.0/8" {
+		t.Fatal("sortRules must not modify its input")
+	}
+}
+
+func TestSubnetSelector(t *testing.T) {
+	sel, proto, err := subnetSelector(mustParseCIDR(t, "16.1.2.0/24"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proto != unix.ETH_P_IP {
+		t.Fatalf("expected protocol %x, got %x", unix.ETH_P_IP, proto)
+	}
+	if len(sel.Keys) != 1 {
+		t.Fatalf("expected a single key, got %d", len(sel.Keys))
+	}
+	if k := sel.Keys[0]; k.Mask != 0xffffff00 || k.Val != 0x10010200 || k.Off != 16 {
+		t.Fatalf("unexpected key: %+v", k)
+	}
+}
+
+func TestSubnetSelectorIPv6(t *testing.T) {
+	sel, proto, err := subnetSelector(mustParseCIDR(t, "fd74:6700:0:1::/64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proto != unix.ETH_P_IPV6 {
+		t.Fatalf("expected protocol %x, got %x", unix.ETH_P_IPV6, proto)
+	}
+
+	expected := []netlink.TcU32Key{
+		{Mask: 0xffffffff, Val: 0xfd746700, Off: 24},
+		{Mask: 0xffffffff, Val: 0x00000001, Off: 28},
+	}
+	if len(sel.Keys) != len(expected) {
+		t.Fatalf("expected %d keys, got %d", len(expected), len(sel.Keys))
+	}
+	for i, k := range sel.Keys {
+		if k != expected[i] {
+			t.Fatalf("unexpected key %d: %+v", i, k)
+		}
+	}
+}
+
+func TestSetRules(t *testing.T) {
+	l, cleanup := testLink(t)
+	defer cleanup()
+
+	countClasses := func() int {
+		classes, err := l.handle.ClassList(l.Link, rootHandle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(classes)
+	}
+
+	countFilters := func() int {
+		filters, err := l.handle.FilterList(l.Link, rootHandle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(filters)
+	}
+
+	rules := []sync.LinkRule{
+		{Subnet: mustParseCIDR(t, "16.1.0.0/16"), LinkShape: sync.LinkShape{Latency: 10 * time.Millisecond}},
+		{Subnet: mustParseCIDR(t, "16.2.0.0/16"), LinkShape: sync.LinkShape{Bandwidth: 1 << 20}},
+	}
+
+	if err := l.SetRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	if c := countClasses(); c != 3 {
+		t.Fatalf("expected 3 classes, got %d", c)
+	}
+	if countFilters() == 0 {
+		t.Fatal("expected filters to be installed")
+	}
+
+	// shrinking the rules tears down the extra classes.
+	if err := l.SetRules(rules[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if c := countClasses(); c != 2 {
+		t.Fatalf("expected 2 classes, got %d", c)
+	}
+
+	if err := l.SetRules(nil); err != nil {
+		t.Fatal(err)
+	}
+	if c := countClasses(); c != 1 {
+		t.Fatalf("expected 1 class, got %d", c)
+	}
+	if c := countFilters(); c != 0 {
+		t.Fatalf("expected no filters, got %d", c)
+	}
+}
@@ -0,0 +1,209 @@
+//+build linux
+
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+// natPrivateAddr is the private address instances behind a NAT send their
+// traffic from. Each instance has a network namespace of its own, so they can
+// all use the same one, like hosts behind NATs of their own would.
+var natPrivateAddr = &net.IPNet{IP: net.IPv4(192, 168, 254, 2), Mask: net.CIDRMask(32, 32)}
+
+// natMappingTimeout is how long, in seconds, the cone NATs keep a mapping
+// after the last outbound packet through it.
+const natMappingTimeout = "300"
+
+// natLink puts the instance behind a NAT of the given type on a link, in the
+// network namespace at netnsPath, replacing the previous one. addr is the
+// address of the instance on the link.
+//
+// The namespace of the instance plays the part of the NAT gateway: the
+// instance sends its traffic from a private address, on the loopback device,
+// which the routes of the link select as source, and which is translated to
+// the address on the link on the way out. That address stands for the
+// external address of the NAT.
+//
+// Inbound traffic only gets through the NAT if it's translated back: replies
+// to outbound traffic are, through conntrack, and so is traffic to the ports
+// the cone NATs have mapped, from anyone (full cone) or from the addresses
+// the instance has sent traffic to from that port (restricted cone).
+// Mappings are kept in an ipset per link. Anything else is dropped. NATs only
+// apply to IPv4 traffic.
+func natLink(ctx context.Context, netnsPath string, l *NetlinkLink, addr *net.IPNet, nat sync.NATType) error {
+	if addr == nil {
+		nat = sync.NATNone
+	}
+
+	if set, create := natSet(l.Attrs().Name, nat); set != "" {
+		if err := ipset(ctx, netnsPath, create...); err != nil {
+			return err
+		}
+	}
+	if err := runIptables(ctx, netnsPath, "iptables", natCommands(l.Attrs().Name, nat)); err != nil {
+		return err
+	}
+	if addr == nil {
+		return nil
+	}
+	return natSource(l, addr, nat != sync.NATNone && nat != sync.NATDefault)
+}
+
+// natSource makes the instance send its traffic on the link from the private
+// address if it's behind a NAT (nated), and from addr otherwise, by setting
+// the source address of the routes of the link.
+func natSource(l *NetlinkLink, addr *net.IPNet, nated bool) error {
+	lo, err := l.handle.LinkByName("lo")
+	if err != nil {
+		return fmt.Errorf("failed to find loopback device: %w", err)
+	}
+
+	private := &netlink.Addr{IPNet: natPrivateAddr}
+	if nated {
+		if err := l.handle.AddrReplace(lo, private); err != nil {
+			return fmt.Errorf("failed to add NAT private address: %w", err)
+		}
+	}
+
+	routes, err := l.handle.RouteList(l.Link, netlink.FAMILY_V4)
+	if err != nil {
+		return fmt.Errorf("failed to list routes of link %s: %w", l.Attrs().Name, err)
+	}
+
+	src := addr.IP
+	if nated {
+		src = natPrivateAddr.IP
+	}
+	for _, r := range routes {
+		if r.Src.Equal(src) {
+			continue
+		}
+		r.Src = src
+		if err := l.handle.RouteReplace(&r); err != nil {
+			return fmt.Errorf("failed to set source address of route %s: %w", r, err)
+		}
+	}
+
+	if !nated {
+		err := l.handle.AddrDel(lo, private)
+		if err != nil && !errors.Is(err, unix.EADDRNOTAVAIL) {
+			return fmt.Errorf("failed to remove NAT private address: %w", err)
+		}
+	}
+	return nil
+}
+
+// natChains returns the names of the inbound, outbound, prerouting and
+// postrouting NAT chains of a link.
+func natChains(ifname string) (in, out, pre, post string) {
+	return "tg-nin-" + ifname, "tg-nout-" + ifname, "tg-npre-" + ifname, "tg-npost-" + ifname
+}
+
+// natSet returns the name of the ipset holding the mappings of a cone NAT of
+// the given type on a link, and the ipset command that creates it, if it
+// doesn't exist yet. The name is empty if the NAT doesn't need one.
+//
+// Full cone NATs map ports for all destinations, so the set holds the mapped
+// ports; restricted cone NATs map them for the addresses the instance sent
+// traffic to, so it holds (address, port) pairs.
+func natSet(ifname string, nat sync.NATType) (string, []string) {
+	switch nat {
+	case sync.NATFullCone:
+		name := "tg-nfc-" + ifname
+		return name, []string{"create", name, "bitmap:port", "range", "0-65535", "timeout", natMappingTimeout, "-exist"}
+	case sync.NATRestrictedCone:
+		name := "tg-nrc-" + ifname
+		return name, []string{"create", name, "hash:ip,port", "timeout", natMappingTimeout, "-exist"}
+	default:
+		return "", nil
+	}
+}
+
+// natCommands returns the iptables commands that set up a NAT of the given
+// type on a link.
+func natCommands(ifname string, nat sync.NATType) []iptablesCmd {
+	in, out, pre, post := natChains(ifname)
+
+	cmds := chainCommands(ifname, in, out)
+	for _, c := range []struct{ hook, dir, chain string }{
+		{"PREROUTING", "-i", pre},
+		{"POSTROUTING", "-o", post},
+	} {
+		cmds = append(cmds,
+			iptablesCmd{unless: []string{"-t", "nat", "-n", "-L", c.chain}, args: []string{"-t", "nat", "-N", c.chain}},
+			iptablesCmd{args: []string{"-t", "nat", "-F", c.chain}},
+			iptablesCmd{
+				unless: []string{"-t", "nat", "-C", c.hook, c.dir, ifname, "-j", c.chain},
+				args:   []string{"-t", "nat", "-A", c.hook, c.dir, ifname, "-j", c.chain},
+			},
+		)
+	}
+
+	var (
+		set, _ = natSet(ifname, nat)
+		to     = natPrivateAddr.IP.String()
+
+		masquerade = iptablesCmd{args: []string{"-t", "nat", "-A", post, "-j", "MASQUERADE"}}
+		replies    = iptablesCmd{args: []string{"-A", in, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"}}
+		mapped     = iptablesCmd{args: []string{"-A", in, "-m", "conntrack", "--ctstate", "DNAT", "-j", "RETURN"}}
+		drop       = iptablesCmd{args: []string{"-A", in, "-j", "DROP"}}
+	)
+
+	switch nat {
+	case sync.NATFullCone:
+		// masquerading preserves ports when it can, so the mapped port is
+		// the source port of the instance.
+		cmds = append(cmds,
+			masquerade,
+			iptablesCmd{args: []string{"-A", out, "-j", "SET", "--add-set", set, "src", "--exist"}},
+			iptablesCmd{args: []string{"-t", "nat", "-A", pre, "-m", "set", "--match-set", set, "dst", "-j", "DNAT", "--to-destination", to}},
+			replies,
+			mapped,
+			drop,
+		)
+
+	case sync.NATRestrictedCone:
+		cmds = append(cmds,
+			masquerade,
+			iptablesCmd{args: []string{"-A", out, "-j", "SET", "--add-set", set, "dst,src", "--exist"}},
+			iptablesCmd{args: []string{"-t", "nat", "-A", pre, "-m", "set", "--match-set", set, "src,dst", "-j", "DNAT", "--to-destination", to}},
+			replies,
+			mapped,
+			drop,
+		)
+
+	case sync.NATPortRestrictedCone:
+		// only replies, from the address and port the instance sent
+		// traffic to, are translated back.
+		cmds = append(cmds, masquerade, replies, drop)
+
+	case sync.NATSymmetric:
+		cmds = append(cmds,
+			iptablesCmd{args: []string{"-t", "nat", "-A", post, "-j", "MASQUERADE", "--random-fully"}},
+			replies,
+			drop,
+		)
+	}
+
+	return cmds
+}
+
+// ipset runs an ipset command in the network namespace at netnsPath.
+func ipset(ctx context.Context, netnsPath string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "nsenter", append([]string{"--net=" + netnsPath, "ipset"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ipset %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+//+build linux
+
+package sidecar
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+func TestNATCommands(t *testing.T) {
+	for _, tc := range []struct {
+		nat      sync.NATType
+		expected []string
+	}{
+		{sync.NATNone, nil},
+		{sync.NATFullCone, []string{
+			"-t nat -A tg-npost-eth1 -j MASQUERADE",
+			"-A tg-nout-eth1 -j SET --add-set tg-nfc-eth1 src --exist",
+			"-t nat -A tg-npre-eth1 -m set --match-set tg-nfc-eth1 dst -j DNAT --to-destination 192.168.254.2",
+			"-A tg-nin-eth1 -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN",
+			"-A tg-nin-eth1 -m conntrack --ctstate DNAT -j RETURN",
+			"-A tg-nin-eth1 -j DROP",
+		}},
+		{sync.NATRestrictedCone, []string{
+			"-t nat -A tg-npost-eth1 -j MASQUERADE",
+			"-A tg-nout-eth1 -j SET --add-set tg-nrc-eth1 dst,src --exist",
+			"-t nat -A tg-npre-eth1 -m set --match-set tg-nrc-eth1 src,dst -j DNAT --to-destination 192.168.254.2",
+			"-A tg-nin-eth1 -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN",
+			"-A tg-nin-eth1 -m conntrack --ctstate DNAT -j RETURN",
+			"-A tg-nin-eth1 -j DROP",
+		}},
+		{sync.NATPortRestrictedCone, []string{
+			"-t nat -A tg-npost-eth1 -j MASQUERADE",
+			"-A tg-nin-eth1 -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN",
+			"-A tg-nin-eth1 -j DROP",
+		}},
+		{sync.NATSymmetric, []string{
+			"-t nat -A tg-npost-eth1 -j MASQUERADE --random-fully",
+			"-A tg-nin-eth1 -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN",
+			"-A tg-nin-eth1 -j DROP",
+		}},
+	} {
+		var rules []string
+		for _, c := range natCommands("eth1", tc.nat) {
+			cmd := strings.Join(c.args, " ")
+			if strings.HasPrefix(cmd, "-A tg-") || strings.HasPrefix(cmd, "-t nat -A tg-") {
+				rules = append(rules, cmd)
+			}
+		}
+		if strings.Join(rules, "\n") != strings.Join(tc.expected, "\n") {
+			t.Errorf("%s: unexpected rules:\n%s", tc.nat, strings.Join(rules, "\n"))
+		}
+	}
+}
+
+func TestNATSet(t *testing.T) {
+	for _, tc := range []struct {
+		nat      sync.NATType
+		expected string
+	}{
+		{sync.NATNone, ""},
+		{sync.NATFullCone, "create tg-nfc-eth1 bitmap:port range 0-65535 timeout 300 -exist"},
+		{sync.NATRestrictedCone, "create tg-nrc-eth1 hash:ip,port timeout 300 -exist"},
+		{sync.NATPortRestrictedCone, ""},
+		{sync.NATSymmetric, ""},
+	} {
+		name, create := natSet("eth1", tc.nat)
+		if cmd := strings.Join(create, " "); cmd != tc.expected {
+			t.Errorf("%s: unexpected ipset command: %q", tc.nat, cmd)
+		}
+		if (name == "") != (tc.expected == "") {
+			t.Errorf("%s: unexpected ipset name: %q", tc.nat, name)
+		}
+	}
+}
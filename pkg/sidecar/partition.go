@@ -0,0 +1,324 @@
+//+build linux
+
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+// partitionEvent is a scheduled change of a partition that is due.
+type partitionEvent struct {
+	name string
+	gen  uint64
+	heal bool
+}
+
+// partitions tracks the partitions of a run and the addresses of its
+// instances, to work out which instances a given instance must be cut off
+// from.
+//
+// Like the scheduler, it times the scheduled changes of partitions in their
+// own goroutines, which deliver them to the network configuration loop
+// through events; it must only be used from that loop.
+type partitions struct {
+	hostname string
+	group    string
+
+	// peers are the addresses of the instances, by sequence number - 1.
+	peers []*sync.InstanceAddress
+	seqs  map[string]int // hostname -> index in peers
+
+	active  map[string]*sync.Partition
+	pending map[string]*sync.Partition // partitions waiting for After.
+	// declared are the last declarations of the partitions; identical ones
+	// written by other instances belong to the same generation. A newer
+	// declaration supersedes the last one, and partitions healed after
+	// their Duration are forgotten, so that declaring them again starts a
+	// new generation.
+	declared map[string]*sync.Partition
+	gens     map[string]uint64
+	gen      uint64
+
+	events chan partitionEvent
+}
+
+func newPartitions(hostname, group string) *partitions {
+	return &partitions{
+		hostname: hostname,
+		group:    group,
+		seqs:     make(map[string]int),
+		active:   make(map[string]*sync.Partition),
+		pending:  make(map[string]*sync.Partition),
+		declared: make(map[string]*sync.Partition),
+		gens:     make(map[string]uint64),
+		events:   make(chan partitionEvent),
+	}
+}
+
+// AddAddress records the address of an instance, and returns whether the
+// partitions need to be applied again.
+func (ps *partitions) AddAddress(addr *sync.InstanceAddress) bool {
+	if idx, ok := ps.seqs[addr.Hostname]; ok {
+		ps.peers[idx] = addr
+	} else {
+		ps.seqs[addr.Hostname] = len(ps.peers)
+		ps.peers = append(ps.peers, addr)
+	}
+	return len(ps.active) > 0
+}
+
+// Update records a partition written by an instance. It returns whether the
+// partitions need to be applied, and the state to signal once they are.
+//
+// A partition identical to the last one declared with the same name, e.g. by
+// another instance, is the same generation, and is ignored, so that its state
+// is signaled once per sidecar.
+func (ps *partitions) Update(ctx context.Context, p *sync.Partition) (bool, sync.State) {
+	if last, ok := ps.declared[p.Name]; ok && reflect.DeepEqual(last, p) {
+		return false, ""
+	}
+	ps.declared[p.Name] = p
+
+	ps.gen++
+	ps.gens[p.Name] = ps.gen
+	delete(ps.pending, p.Name)
+
+	if p.Healed {
+		delete(ps.active, p.Name)
+		return true, p.State
+	}
+
+	if p.After > 0 {
+		delete(ps.active, p.Name)
+		ps.pending[p.Name] = p
+		ps.schedule(ctx, p.After, partitionEvent{name: p.Name, gen: ps.gen})
+		return true, ""
+	}
+
+	ps.activate(ctx, p)
+	return true, p.State
+}
+
+// Fire handles a scheduled change of a partition. It returns whether the
+// partitions need to be applied, and the state to signal once they are.
+func (ps *partitions) Fire(ctx context.Context, ev partitionEvent) (bool, sync.State) {
+	if ps.gens[ev.name] != ev.gen {
+		// the partition has been replaced since.
+		return false, ""
+	}
+
+	if ev.heal {
+		p, ok := ps.active[ev.name]
+		if !ok {
+			return false, ""
+		}
+		delete(ps.active, ev.name)
+		delete(ps.declared, ev.name)
+		return true, p.HealState
+	}
+
+	p, ok := ps.pending[ev.name]
+	if !ok {
+		return false, ""
+	}
+	delete(ps.pending, ev.name)
+	ps.activate(ctx, p)
+	return true, p.State
+}
+
+func (ps *partitions) activate(ctx context.Context, p *sync.Partition) {
+	ps.active[p.Name] = p
+	if p.Duration > 0 {
+		ps.schedule(ctx, p.Duration, partitionEvent{name: p.Name, gen: ps.gens[p.Name], heal: true})
+	}
+}
+
+func (ps *partitions) schedule(ctx context.Context, d time.Duration, ev partitionEvent) {
+	go func() {
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		select {
+		case ps.events <- ev:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// Dropped returns the addresses of the instances this instance is cut off
+// from: those on a different side of an active partition, and on none of the
+// sides this instance is on.
+func (ps *partitions) Dropped() []net.IP {
+	dropped := make(map[string]net.IP)
+
+	var seq int64 // 0 until we're registered.
+	if idx, ok := ps.seqs[ps.hostname]; ok {
+		seq = int64(idx + 1)
+	}
+
+	for _, p := range ps.active {
+		var (
+			mine = make([]bool, 0, len(p.Sides))
+			in   bool
+		)
+		for _, side := range p.Sides {
+			c := side.Contains(ps.group, seq)
+			mine = append(mine, c)
+			in = in || c
+		}
+		if !in {
+			continue
+		}
+
+		for idx, peer := range ps.peers {
+			if peer.Hostname == ps.hostname {
+				continue
+			}
+
+			var theirs, shared bool
+			for i, side := range p.Sides {
+				if side.Contains(peer.Group, int64(idx+1)) {
+					theirs = true
+					shared = shared || mine[i]
+				}
+			}
+			if !theirs || shared {
+				continue
+			}
+
+			for _, ip := range []net.IP{peer.IPv4, peer.IPv6} {
+				if ip != nil {
+					dropped[ip.String()] = ip
+				}
+			}
+		}
+	}
+
+	ips := make([]net.IP, 0, len(dropped))
+	for _, ip := range dropped {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(ips[i], ips[j]) < 0
+	})
+	return ips
+}
+
+// partitionChains returns the names of the inbound and outbound partition
+// chains of a link.
+func partitionChains(ifname string) (in, out string) {
+	return "tg-pin-" + ifname, "tg-pout-" + ifname
+}
+
+// partitionLink drops all the traffic to and from peers on a link, in the
+// network namespace at netnsPath, replacing the peers previously dropped.
+//
+// Like filters, partitions are implemented with iptables, in chains of their
+// own, so that they're unaffected by the configuration of the link.
+func partitionLink(ctx context.Context, netnsPath string, ifname string, peers []net.IP, ipv6 bool) error {
+	var peers4, peers6 []net.IP
+	for _, ip := range peers {
+		if ip.To4() != nil {
+			peers4 = append(peers4, ip)
+		} else {
+			peers6 = append(peers6, ip)
+		}
+	}
+
+	if err := runIptables(ctx, netnsPath, "iptables", partitionCommands(ifname, peers4)); err != nil {
+		return err
+	}
+	if !ipv6 && len(peers6) == 0 {
+		return nil
+	}
+	return runIptables(ctx, netnsPath, "ip6tables", partitionCommands(ifname, peers6))
+}
+
+// partitionCommands returns the iptables commands that drop the traffic to
+// and from peers on a link.
+func partitionCommands(ifname string, peers []net.IP) []iptablesCmd {
+	in, out := partitionChains(ifname)
+	cmds := chainCommands(ifname, in, out)
+	for _, ip := range peers {
+		cmds = append(cmds,
+			iptablesCmd{args: []string{"-A", in, "-s", ip.String(), "-j", "DROP"}},
+			iptablesCmd{args: []string{"-A", out, "-d", ip.String(), "-j", "DROP"}},
+		)
+	}
+	return cmds
+}
+
+// publishAddress publishes the address of the instance on the data network,
+// unless it's the same as the last one published.
+func publishAddress(ctx context.Context, instance *Instance, last *sync.InstanceAddress) (*sync.InstanceAddress, error) {
+	addr := &sync.InstanceAddress{
+		Hostname: instance.Hostname,
+		Group:    instance.RunEnv.TestGroupID,
+	}
+
+	ipv4, ipv6 := instance.Network.Addresses("default")
+	if ipv4 != nil {
+		addr.IPv4 = ipv4.IP
+	}
+	if ipv6 != nil {
+		addr.IPv6 = ipv6.IP
+	}
+
+	if last != nil && last.IPv4.Equal(addr.IPv4) && last.IPv6.Equal(addr.IPv6) {
+		return last, nil
+	}
+
+	if _, err := instance.Writer.Write(ctx, sync.InstanceAddressSubtree, addr); err != nil {
+		return nil, fmt.Errorf("failed to publish instance address: %w", err)
+	}
+	return addr, nil
+}
+
+// applyPartitions cuts the instance off from the instances on the other sides
+// of the active partitions. Failing to is logged, but isn't fatal: the next
+// change may succeed.
+func applyPartitions(ctx context.Context, instance *Instance, ps *partitions) (int, error) {
+	dropped := ps.Dropped()
+	instance.S().Infow("applying partitions", "dropped", len(dropped))
+
+	if err := instance.Network.Partition(ctx, "default", dropped); err != nil {
+		instance.S().Warnw("failed to apply partitions", "dropped", len(dropped), "err", err)
+		return len(dropped), fmt.Errorf("failed to apply partitions: %w", err)
+	}
+	return len(dropped), nil
+}
+
+// applyPartitionChange applies the partitions following a change of the named
+// partition, reports the outcome to the instances, and signals state, if not
+// empty, if they were applied. It only errors if the sync service does.
+func applyPartitionChange(ctx context.Context, instance *Instance, ps *partitions, name string, state sync.State) error {
+	n, err := applyPartitions(ctx, instance, ps)
+
+	report := &sync.PartitionReport{Partition: name, Dropped: n}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if _, err := instance.Writer.Write(ctx, sync.PartitionReportSubtree(instance.Hostname), report); err != nil {
+		return fmt.Errorf("failed to publish partition report: %w", err)
+	}
+
+	if state != "" && err == nil {
+		if _, err := instance.Writer.SignalEntry(ctx, state); err != nil {
+			return fmt.Errorf("failed to signal partition state %s: %w", state, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+//+build linux
+
+package sidecar
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+func testPartitions() *partitions {
+	ps := newPartitions("a1", "a")
+	for _, addr := range []*sync.InstanceAddress{
+		{Hostname: "a1", Group: "a", IPv4: net.ParseIP("16.0.0.2")},
+		{Hostname: "a2", Group: "a", IPv4: net.ParseIP("16.0.0.3")},
+		{Hostname: "b1", Group: "b", IPv4: net.ParseIP("16.0.0.4"), IPv6: net.ParseIP("fd74:6700::4")},
+		{Hostname: "c1", Group: "c", IPv4: net.ParseIP("16.0.0.5")},
+	} {
+		ps.AddAddress(addr)
+	}
+	return ps
+}
+
+func dropped(ps *partitions) string {
+	var out []string
+	for _, ip := range ps.Dropped() {
+		out = append(out, ip.String())
+	}
+	return strings.Join(out, ",")
+}
+
+func TestPartitionsByGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ps := testPartitions()
+
+	apply, state := ps.Update(ctx, &sync.Partition{
+		Name:  "split",
+		Sides: []sync.PartitionSide{{Groups: []string{"a"}}, {Groups: []string{"b"}}},
+		State: "split",
+	})
+	if !apply || state != "split" {
+		t.Fatalf("expected the partition to apply and signal split, got %t %q", apply, state)
+	}
+
+	// c is on no side, so it's not affected.
+	if d := dropped(ps); d != "16.0.0.4,fd74:6700::4" {
+		t.Fatalf("unexpected dropped peers: %s", d)
+	}
+
+	if apply, state = ps.Update(ctx, &sync.Partition{Name: "split", Healed: true, State: "healed"}); !apply || state != "healed" {
+		t.Fatalf("expected the heal to apply and signal healed, got %t %q", apply, state)
+	}
+	if d := dropped(ps); d != "" {
+		t.Fatalf("expected no dropped peers once healed, got %s", d)
+	}
+}
+
+func TestPartitionsBySeq(t *testing.T) {
+	ps := testPartitions()
+
+	// a1 is seq 1 and a2 seq 2; a1 is on the side of c1 (seq 4).
+	ps.Update(context.Background(), &sync.Partition{
+		Name:  "split",
+		Sides: []sync.PartitionSide{{Seqs: []int64{1, 4}}, {Seqs: []int64{2, 3}}},
+	})
+	if d := dropped(ps); d != "16.0.0.3,16.0.0.4,fd74:6700::4" {
+		t.Fatalf("unexpected dropped peers: %s", d)
+	}
+
+	// addresses can change.
+	if !ps.AddAddress(&sync.InstanceAddress{Hostname: "a2", Group: "a", IPv4: net.ParseIP("16.0.1.3")}) {
+		t.Fatal("expected an address change to reapply active partitions")
+	}
+	if d := dropped(ps); d != "16.0.0.4,16.0.1.3,fd74:6700::4" {
+		t.Fatalf("unexpected dropped peers: %s", d)
+	}
+}
+
+func TestPartitionsDeclaredTwice(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ps := testPartitions()
+
+	declare := func() *sync.Partition {
+		return &sync.Partition{
+			Name:  "split",
+			Sides: []sync.PartitionSide{{Groups: []string{"a"}}, {Groups: []string{"b"}}},
+			State: "split",
+		}
+	}
+
+	if apply, state := ps.Update(ctx, declare()); !apply || state != "split" {
+		t.Fatalf("expected the partition to apply and signal split, got %t %q", apply, state)
+	}
+	// another instance declares the same partition.
+	if apply, state := ps.Update(ctx, declare()); apply || state != "" {
+		t.Fatalf("expected an identical partition to be ignored, got %t %q", apply, state)
+	}
+
+	// healing it, then declaring it again, is a new generation.
+	heal := func() *sync.Partition {
+		return &sync.Partition{Name: "split", Healed: true, State: "healed"}
+	}
+	if apply, state := ps.Update(ctx, heal()); !apply || state != "healed" {
+		t.Fatalf("expected the heal to apply and signal healed, got %t %q", apply, state)
+	}
+	if apply, _ := ps.Update(ctx, heal()); apply {
+		t.Fatal("expected an identical heal to be ignored")
+	}
+	if apply, state := ps.Update(ctx, declare()); !apply || state != "split" {
+		t.Fatalf("expected the partition to apply again, got %t %q", apply, state)
+	}
+}
+
+func TestPartitionsSchedule(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ps := testPartitions()
+
+	apply, state := ps.Update(ctx, &sync.Partition{
+		Name:      "split",
+		Sides:     []sync.PartitionSide{{Groups: []string{"a"}}, {Groups: []string{"b"}}},
+		After:     time.Millisecond,
+		Duration:  time.Millisecond,
+		State:     "split",
+		HealState: "healed",
+	})
+	if !apply || state != "" {
+		t.Fatalf("expected a delayed partition not to signal yet, got %t %q", apply, state)
+	}
+	if d := dropped(ps); d != "" {
+		t.Fatalf("expected no dropped peers before the partition starts, got %s", d)
+	}
+
+	for _, expected := range []sync.State{"split", "healed"} {
+		select {
+		case ev := <-ps.events:
+			if apply, state := ps.Fire(ctx, ev); !apply || state != expected {
+				t.Fatalf("expected %q, got %t %q", expected, apply, state)
+			}
+			if expected == "split" && dropped(ps) == "" {
+				t.Fatal("expected dropped peers once the partition started")
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out")
+		}
+	}
+
+	if d := dropped(ps); d != "" {
+		t.Fatalf("expected no dropped peers once healed, got %s", d)
+	}
+}
+
+func TestPartitionsDeclaredAgainAfterDuration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ps := testPartitions()
+
+	declare := func() *sync.Partition {
+		return &sync.Partition{
+			Name:      "split",
+			Sides:     []sync.PartitionSide{{Groups: []string{"a"}}, {Groups: []string{"b"}}},
+			Duration:  time.Millisecond,
+			State:     "split",
+			HealState: "healed",
+		}
+	}
+
+	if apply, state := ps.Update(ctx, declare()); !apply || state != "split" {
+		t.Fatalf("expected the partition to apply and signal split, got %t %q", apply, state)
+	}
+
+	select {
+	case ev := <-ps.events:
+		if apply, state := ps.Fire(ctx, ev); !apply || state != "healed" {
+			t.Fatalf("expected the partition to heal, got %t %q", apply, state)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out")
+	}
+
+	// once healed, declaring the same partition again is a new generation.
+	if apply, state := ps.Update(ctx, declare()); !apply || state != "split" {
+		t.Fatalf("expected the partition to apply again, got %t %q", apply, state)
+	}
+	if d := dropped(ps); d != "16.0.0.4,fd74:6700::4" {
+		t.Fatalf("unexpected dropped peers: %s", d)
+	}
+}
+
+func TestPartitionCommands(t *testing.T) {
+	cmds := partitionCommands("eth1", []net.IP{net.ParseIP("16.0.0.4")})
+
+	expected := []string{
+		"tg-pin-eth1 -s 16.0.0.4 -j DROP",
+		"tg-pout-eth1 -d 16.0.0.4 -j DROP",
+	}
+	if rules := appended(cmds); strings.Join(rules, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected rules: %v", rules)
+	}
+}
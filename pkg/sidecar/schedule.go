@@ -0,0 +1,153 @@
+//+build linux
+
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+// linkStep is a step of a link schedule that is due.
+type linkStep struct {
+	network string
+	gen     uint64
+	step    int
+	loop    int
+	shape   sync.LinkShape
+}
+
+type runningSchedule struct {
+	gen    uint64
+	cancel context.CancelFunc
+}
+
+// scheduler runs the link schedules of the networks of an instance.
+//
+// Each schedule runs in its own goroutine, which only times its steps. The
+// steps themselves are applied by the network configuration loop, which
+// receives them from steps, so that networks are only ever configured from a
+// single goroutine. The scheduler must only be used from that goroutine too.
+type scheduler struct {
+	steps   chan linkStep
+	gen     uint64
+	running map[string]runningSchedule
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		steps:   make(chan linkStep),
+		running: make(map[string]runningSchedule),
+	}
+}
+
+// validateSchedule checks that a schedule can be run.
+func validateSchedule(sched *sync.LinkSchedule) error {
+	if len(sched.Steps) == 0 {
+		return errors.New("schedule has no steps")
+	}
+
+	var prev time.Duration
+	for i, s := range sched.Steps {
+		if s.Offset < prev {
+			return fmt.Errorf("step %d: offsets must be positive and sorted", i)
+		}
+		// steps only reshape the link; its filters stay as configured.
+		if s.Filter != sync.Accept {
+			return fmt.Errorf("step %d: steps can't filter traffic", i)
+		}
+		prev = s.Offset
+	}
+
+	if sched.Period < 0 || (sched.Period > 0 && sched.Period <= prev) {
+		return fmt.Errorf("period %s must be greater than the offset of the last step", sched.Period)
+	}
+	return nil
+}
+
+// Start starts the schedule of a network, stopping its previous one, if any.
+// The schedule must have been validated.
+func (s *scheduler) Start(ctx context.Context, network string, sched sync.LinkSchedule) {
+	s.Stop(network)
+
+	s.gen++
+	ctx, cancel := context.WithCancel(ctx)
+	s.running[network] = runningSchedule{gen: s.gen, cancel: cancel}
+
+	go s.run(ctx, network, s.gen, sched)
+}
+
+// Stop stops the schedule of a network, if any.
+func (s *scheduler) Stop(network string) {
+	if r, ok := s.running[network]; ok {
+		r.cancel()
+		delete(s.running, network)
+	}
+}
+
+// Close stops all schedules.
+func (s *scheduler) Close() {
+	for network := range s.running {
+		s.Stop(network)
+	}
+}
+
+// current returns whether a step belongs to the running schedule of its
+// network. The steps of a schedule can still be received after it's been
+// stopped, and must then be ignored.
+func (s *scheduler) current(step linkStep) bool {
+	r, ok := s.running[step.network]
+	return ok && r.gen == step.gen
+}
+
+func (s *scheduler) run(ctx context.Context, network string, gen uint64, sched sync.LinkSchedule) {
+	start := time.Now()
+	for loop := 0; ; loop++ {
+		// steps are timed from the start of the schedule, so that delays in
+		// applying them don't accumulate.
+		base := start.Add(time.Duration(loop) * sched.Period)
+		for i, step := range sched.Steps {
+			t := time.NewTimer(time.Until(base.Add(step.Offset)))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+
+			select {
+			case s.steps <- linkStep{network: network, gen: gen, step: i, loop: loop, shape: step.LinkShape}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if sched.Period == 0 {
+			return
+		}
+	}
+}
+
+// applyStep applies a step of a link schedule, and reports it. Failing to
+// apply a step doesn't stop the schedule.
+func applyStep(ctx context.Context, instance *Instance, step linkStep) {
+	report := &sync.LinkStepReport{
+		Network: step.network,
+		Step:    step.step,
+		Loop:    step.loop,
+	}
+
+	if err := instance.Network.ShapeLink(ctx, step.network, step.shape); err != nil {
+		instance.S().Warnw("failed to apply link schedule step", "network", step.network, "step", step.step, "loop", step.loop, "err", err)
+		report.Error = err.Error()
+	} else {
+		instance.S().Infow("applied link schedule step", "network", step.network, "step", step.step, "loop", step.loop, "shape", step.shape)
+	}
+
+	if _, err := instance.Writer.Write(ctx, sync.LinkScheduleSubtree(instance.Hostname), report); err != nil {
+		instance.S().Warnw("failed to report link schedule step", "network", step.network, "err", err)
+	}
+}
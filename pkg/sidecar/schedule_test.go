@@ -0,0 +1,93 @@
+//+build linux
+
+package sidecar
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+func TestValidateSchedule(t *testing.T) {
+	steps := []sync.LinkStep{{Offset: 0}, {Offset: time.Second}}
+
+	for _, tc := range []struct {
+		sched sync.LinkSchedule
+		valid bool
+	}{
+		{sync.LinkSchedule{Steps: steps}, true},
+		{sync.LinkSchedule{Steps: steps, Period: 2 * time.Second}, true},
+		{sync.LinkSchedule{}, false},
+		{sync.LinkSchedule{Steps: []sync.LinkStep{{Offset: time.Second}, {Offset: 0}}}, false},
+		{sync.LinkSchedule{Steps: []sync.LinkStep{{Offset: -time.Second}}}, false},
+		{sync.LinkSchedule{Steps: steps, Period: time.Second}, false},
+		{sync.LinkSchedule{Steps: steps, Period: -time.Second}, false},
+		{sync.LinkSchedule{Steps: []sync.LinkStep{{LinkShape: sync.LinkShape{Filter: sync.Drop}}}}, false},
+	} {
+		if err := validateSchedule(&tc.sched); (err == nil) != tc.valid {
+			t.Errorf("schedule %+v: expected valid=%t, got %v", tc.sched, tc.valid, err)
+		}
+	}
+}
+
+func TestSchedulerLoops(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s := newScheduler()
+	defer s.Close()
+
+	s.Start(ctx, "default", sync.LinkSchedule{
+		Steps: []sync.LinkStep{
+			{Offset: 0, LinkShape: sync.LinkShape{Bandwidth: 1}},
+			{Offset: 5 * time.Millisecond, LinkShape: sync.LinkShape{Bandwidth: 2}},
+		},
+		Period: 10 * time.Millisecond,
+	})
+
+	expected := []struct{ loop, step int }{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
+	for _, e := range expected {
+		select {
+		case step := <-s.steps:
+			if !s.current(step) {
+				t.Fatal("expected step to belong to the running schedule")
+			}
+			if step.loop != e.loop || step.step != e.step || step.shape.Bandwidth != uint64(e.step+1) {
+				t.Fatalf("expected loop %d step %d, got %+v", e.loop, e.step, step)
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for steps")
+		}
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s := newScheduler()
+	defer s.Close()
+
+	s.Start(ctx, "default", sync.LinkSchedule{Steps: []sync.LinkStep{{Offset: 0}}})
+
+	// wait for the step to be due, then replace the schedule: the step is
+	// stale.
+	time.Sleep(10 * time.Millisecond)
+	s.Start(ctx, "default", sync.LinkSchedule{Steps: []sync.LinkStep{{Offset: time.Hour}}})
+
+	select {
+	case step := <-s.steps:
+		if s.current(step) {
+			t.Fatal("expected the step of the replaced schedule to be stale")
+		}
+	case <-time.After(100 * time.Millisecond):
+		// the replaced schedule gave up on delivering the step.
+	}
+
+	s.Stop("default")
+	if len(s.running) != 0 {
+		t.Fatal("expected no running schedules")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/ipfs/testground/pkg/logging"
 	"github.com/ipfs/testground/sdk/sync"
@@ -61,16 +62,35 @@ func Run(runnerName string) error {
 			}
 		}()
 
+		// The NAT the instance is put behind, unless the test case asks
+		// otherwise.
+		nat, err := sync.ParseNATType(instance.RunEnv.TestNAT)
+		if err != nil {
+			return err
+		}
+
 		// Network configuration loop.
-		err := instance.Network.ConfigureNetwork(ctx, &sync.NetworkConfig{
+		err = instance.Network.ConfigureNetwork(ctx, &sync.NetworkConfig{
 			Network: "default",
 			Enable:  true,
+			NAT:     nat,
 		})
 
 		if err != nil {
 			return err
 		}
 
+		// Capture the packets of the instance, if the runner asked us to.
+		capt := newCapturer(instance)
+		capt.Start(ctx, instance)
+
+		// Publish our address, so that the sidecars of the other instances
+		// can cut us off when partitioning the network.
+		addr, err := publishAddress(ctx, instance, nil)
+		if err != nil {
+			return err
+		}
+
 		// Wait for all the sidecars to enter the "network-initialized" state.
 		const netInitState = "network-initialized"
 		if _, err = instance.Writer.SignalEntry(ctx, netInitState); err != nil {
@@ -95,6 +115,43 @@ func Run(runnerName string) error {
 		if err := instance.Watcher.Subscribe(ctx, subtree, networkChanges); err != nil {
 			return fmt.Errorf("failed to subscribe to network changes: %s", err)
 		}
+
+		addresses := make(chan *sync.InstanceAddress, 16)
+		if err := instance.Watcher.Subscribe(ctx, sync.InstanceAddressSubtree, addresses); err != nil {
+			return fmt.Errorf("failed to subscribe to instance addresses: %w", err)
+		}
+
+		partitionChanges := make(chan *sync.Partition, 16)
+		if err := instance.Watcher.Subscribe(ctx, sync.PartitionSubtree, partitionChanges); err != nil {
+			return fmt.Errorf("failed to subscribe to partitions: %w", err)
+		}
+
+		// seq is the sequence number of the last network change, which
+		// matches the one the instance got when writing it.
+		var seq int64
+
+		sched := newScheduler()
+		defer sched.Close()
+
+		parts := newPartitions(instance.Hostname, instance.RunEnv.TestGroupID)
+
+		// Sample the link statistics of the instance, if the runner asked
+		// us to.
+		var (
+			stats     *statsRecorder
+			statsTick <-chan time.Time
+		)
+		if interval := instance.RunEnv.TestLinkStats; interval > 0 {
+			if stats, err = newStatsRecorder(instance); err != nil {
+				return err
+			}
+			defer stats.Close()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			statsTick = ticker.C
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -109,11 +166,26 @@ func Run(runnerName string) error {
 					return nil
 				}
 
-				instance.S().Infow("applying network change", "network", cfg)
-				if err := instance.Network.ConfigureNetwork(ctx, cfg); err != nil {
-					return fmt.Errorf("failed to update network %s: %w", cfg.Network, err)
+				// Report the outcome of the request to the instance, rather
+				// than giving up on it: it'd otherwise wait for its state
+				// forever.
+				seq++
+				result := &sync.NetworkResult{Seq: seq, Network: cfg.Network}
+				if err := applyNetworkConfig(ctx, instance, sched, cfg, nat); err != nil {
+					instance.S().Warnw("failed to apply network change", "network", cfg.Network, "err", err)
+					result.Error = err.Error()
+				}
+				if _, err := instance.Writer.Write(ctx, sync.NetworkResultSubtree(instance.Hostname), result); err != nil {
+					return fmt.Errorf("failed to publish network change result: %w", err)
+				}
+
+				// the link may have changed, even if the configuration
+				// failed halfway.
+				capt.Start(ctx, instance)
+				if addr, err = publishAddress(ctx, instance, addr); err != nil {
+					return err
 				}
-				if cfg.State != "" {
+				if cfg.State != "" && result.Error == "" {
 					_, err := instance.Writer.SignalEntry(ctx, cfg.State)
 					if err != nil {
 						return fmt.Errorf(
@@ -123,7 +195,66 @@ func Run(runnerName string) error {
 						)
 					}
 				}
+			case step := <-sched.steps:
+				if sched.current(step) {
+					applyStep(ctx, instance, step)
+				}
+			case a, ok := <-addresses:
+				if !ok {
+					instance.S().Debugw("addresses channel closed", "instance", instance.Hostname)
+					return nil
+				}
+				if parts.AddAddress(a) {
+					_, _ = applyPartitions(ctx, instance, parts)
+				}
+			case p, ok := <-partitionChanges:
+				if !ok {
+					instance.S().Debugw("partitionChanges channel closed", "instance", instance.Hostname)
+					return nil
+				}
+				instance.S().Infow("applying partition change", "partition", p.Name, "healed", p.Healed)
+				if apply, state := parts.Update(ctx, p); apply {
+					if err := applyPartitionChange(ctx, instance, parts, p.Name, state); err != nil {
+						return err
+					}
+				}
+			case err := <-capt.exited:
+				capt.Exited(ctx, instance, err)
+			case <-statsTick:
+				stats.Record(ctx, instance)
+			case ev := <-parts.events:
+				if apply, state := parts.Fire(ctx, ev); apply {
+					if err := applyPartitionChange(ctx, instance, parts, ev.name, state); err != nil {
+						return err
+					}
+				}
 			}
 		}
 	})
 }
+
+// applyNetworkConfig applies a network configuration requested by the
+// instance, which replaces the link schedule of the network, if any.
+func applyNetworkConfig(ctx context.Context, instance *Instance, sched *scheduler, cfg *sync.NetworkConfig, nat sync.NATType) error {
+	if cfg.Schedule != nil {
+		if err := validateSchedule(cfg.Schedule); err != nil {
+			return fmt.Errorf("invalid link schedule for network %s: %w", cfg.Network, err)
+		}
+	}
+
+	sched.Stop(cfg.Network)
+
+	// The NAT the instance is put behind, unless it asks otherwise.
+	if cfg.NAT == sync.NATDefault {
+		cfg.NAT = nat
+	}
+
+	instance.S().Infow("applying network change", "network", cfg)
+	if err := instance.Network.ConfigureNetwork(ctx, cfg); err != nil {
+		return fmt.Errorf("failed to update network %s: %w", cfg.Network, err)
+	}
+	if cfg.Schedule != nil {
+		sched.Start(ctx, cfg.Network, *cfg.Schedule)
+	}
+	return nil
+}
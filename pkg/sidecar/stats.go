@@ -0,0 +1,220 @@
+//+build linux
+
+package sidecar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+// linkStatsFile is the file, in the outputs of an instance, to which the
+// sidecar appends the link statistics samples of the instance, as JSON lines.
+const linkStatsFile = "link-stats.out"
+
+// TCA_STATS2 nested attributes (see linux/gen_stats.h).
+const (
+	tcaStatsBasic = 1
+	tcaStatsQueue = 3
+	tcaStatsPkt64 = 8
+)
+
+// statsRecorder samples the traffic statistics of the links of an instance,
+// and records them to its outputs and, optionally, to the sync service.
+//
+// Like the scheduler, it must only be used from the network configuration
+// loop, as it reads the state of the networks.
+type statsRecorder struct {
+	enc     *json.Encoder
+	out     *os.File
+	publish bool
+}
+
+func newStatsRecorder(instance *Instance) (*statsRecorder, error) {
+	r := &statsRecorder{publish: instance.RunEnv.TestLinkStatsPublish}
+	if instance.OutputsPath == "" {
+		return r, nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(instance.OutputsPath, linkStatsFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open link stats file: %w", err)
+	}
+	r.out, r.enc = f, json.NewEncoder(f)
+	return r, nil
+}
+
+// Record samples the statistics of the active links of the instance. Failing
+// to sample or record them is logged, but isn't fatal.
+func (r *statsRecorder) Record(ctx context.Context, instance *Instance) {
+	for _, network := range instance.Network.ListActive() {
+		stats, err := instance.Network.LinkStats(network)
+		if err != nil {
+			instance.S().Warnw("failed to sample link stats", "network", network, "err", err)
+			continue
+		}
+
+		if r.enc != nil {
+			if err := r.enc.Encode(stats); err != nil {
+				instance.S().Warnw("failed to write link stats", "network", network, "err", err)
+			}
+		}
+
+		if r.publish {
+			if _, err := instance.Writer.Write(ctx, sync.LinkStatsSubtree(instance.Hostname), stats); err != nil {
+				instance.S().Warnw("failed to publish link stats", "network", network, "err", err)
+			}
+		}
+	}
+}
+
+// Close closes the outputs file, if any.
+func (r *statsRecorder) Close() error {
+	if r.out == nil {
+		return nil
+	}
+	return r.out.Close()
+}
+
+// linkStats samples the traffic statistics of a link, in the network
+// namespace at netnsPath, from the root qdiscs of the link and of its IFB
+// device, if ingress is shaped.
+func linkStats(netnsPath string, network string, l *NetlinkLink) (*sync.LinkStats, error) {
+	qdiscs, err := rootQdiscStats(netnsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	egress, ok := qdiscs[l.Attrs().Index]
+	if !ok {
+		return nil, fmt.Errorf("no root qdisc on link %s", l.Attrs().Name)
+	}
+
+	stats := &sync.LinkStats{
+		Network: network,
+		Time:    time.Now(),
+		Egress:  egress,
+	}
+	if l.ingress != nil {
+		if ingress, ok := qdiscs[l.ingress.Attrs().Index]; ok {
+			stats.Ingress = &ingress
+		}
+	}
+	return stats, nil
+}
+
+// rootQdiscStats returns the statistics of the root qdiscs in the network
+// namespace at netnsPath, by link index.
+//
+// The netlink library doesn't decode qdisc statistics, so we dump the qdiscs
+// ourselves.
+func rootQdiscStats(netnsPath string) (map[int]sync.QdiscStats, error) {
+	ns, err := netns.GetFromPath(netnsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open net namespace: %w", err)
+	}
+	defer ns.Close()
+
+	s, err := nl.GetNetlinkSocketAt(ns, netns.None(), unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	defer s.Close()
+
+	req := nl.NewNetlinkRequest(unix.RTM_GETQDISC, unix.NLM_F_DUMP)
+	req.AddData(&nl.TcMsg{Family: nl.FAMILY_ALL})
+	req.Sockets = map[int]*nl.SocketHandle{unix.NETLINK_ROUTE: {Socket: s}}
+
+	msgs, err := req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWQDISC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list qdiscs: %w", err)
+	}
+	return parseRootQdiscStats(msgs)
+}
+
+// parseRootQdiscStats parses the statistics of the root qdiscs out of
+// RTM_NEWQDISC messages.
+func parseRootQdiscStats(msgs [][]byte) (map[int]sync.QdiscStats, error) {
+	stats := make(map[int]sync.QdiscStats)
+	for _, m := range msgs {
+		msg := nl.DeserializeTcMsg(m)
+		if msg.Parent != netlink.HANDLE_ROOT {
+			continue
+		}
+
+		attrs, err := nl.ParseRouteAttr(m[msg.Len():])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse qdisc attributes: %w", err)
+		}
+
+		for _, attr := range attrs {
+			if attr.Attr.Type != nl.TCA_STATS2 {
+				continue
+			}
+			st, err := parseTcStats2(attr.Value)
+			if err != nil {
+				return nil, err
+			}
+			stats[int(msg.Ifindex)] = st
+		}
+	}
+	return stats, nil
+}
+
+func parseTcStats2(b []byte) (sync.QdiscStats, error) {
+	var (
+		st     sync.QdiscStats
+		pkt64  bool
+		native = nl.NativeEndian()
+	)
+
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return st, fmt.Errorf("failed to parse qdisc stats: %w", err)
+	}
+
+	for _, attr := range attrs {
+		v := attr.Value
+		switch attr.Attr.Type {
+		case tcaStatsBasic:
+			// struct gnet_stats_basic { __u64 bytes; __u32 packets; }
+			if len(v) < 12 {
+				return st, errors.New("short basic qdisc stats")
+			}
+			st.Bytes = native.Uint64(v[0:8])
+			if !pkt64 {
+				st.Packets = uint64(native.Uint32(v[8:12]))
+			}
+		case tcaStatsPkt64:
+			// the 64-bit packet count, on kernels whose 32-bit one wraps.
+			if len(v) < 8 {
+				return st, errors.New("short packet qdisc stats")
+			}
+			st.Packets = native.Uint64(v[0:8])
+			pkt64 = true
+		case tcaStatsQueue:
+			// struct gnet_stats_queue { __u32 qlen, backlog, drops,
+			// requeues, overlimits; }
+			if len(v) < 20 {
+				return st, errors.New("short queue qdisc stats")
+			}
+			st.Qlen = native.Uint32(v[0:4])
+			st.Backlog = native.Uint32(v[4:8])
+			st.Drops = native.Uint32(v[8:12])
+			st.Requeues = native.Uint32(v[12:16])
+			st.Overlimits = native.Uint32(v[16:20])
+		}
+	}
+	return st, nil
+}
@@ -0,0 +1,85 @@
+//+build linux
+
+package sidecar
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+func qdiscMsg(ifindex int32, parent uint32, stats ...*nl.RtAttr) []byte {
+	msg := (&nl.TcMsg{Family: nl.FAMILY_ALL, Ifindex: ifindex, Parent: parent}).Serialize()
+	msg = append(msg, nl.NewRtAttr(nl.TCA_KIND, nl.ZeroTerminated("htb")).Serialize()...)
+
+	stats2 := nl.NewRtAttr(nl.TCA_STATS2, nil)
+	for _, s := range stats {
+		stats2.AddChild(s)
+	}
+	return append(msg, stats2.Serialize()...)
+}
+
+func TestParseRootQdiscStats(t *testing.T) {
+	native := nl.NativeEndian()
+
+	basic := make([]byte, 16)
+	native.PutUint64(basic[0:], 123456)
+	native.PutUint32(basic[8:], 789)
+
+	queue := make([]byte, 20)
+	for i, v := range []uint32{2, 3000, 4, 5, 6} {
+		native.PutUint32(queue[i*4:], v)
+	}
+
+	pkt64 := make([]byte, 8)
+	native.PutUint64(pkt64, 1<<33)
+
+	msgs := [][]byte{
+		qdiscMsg(2, netlink.HANDLE_ROOT,
+			nl.NewRtAttr(tcaStatsBasic, basic),
+			nl.NewRtAttr(tcaStatsQueue, queue),
+		),
+		// not a root qdisc.
+		qdiscMsg(2, netlink.MakeHandle(1, 2), nl.NewRtAttr(tcaStatsBasic, basic)),
+		qdiscMsg(3, netlink.HANDLE_ROOT,
+			nl.NewRtAttr(tcaStatsBasic, basic),
+			nl.NewRtAttr(tcaStatsPkt64, pkt64),
+		),
+	}
+
+	stats, err := parseRootQdiscStats(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 2 {
+		t.Fatalf("expected stats for 2 links, got %d", len(stats))
+	}
+
+	expected := sync.QdiscStats{
+		Bytes:      123456,
+		Packets:    789,
+		Qlen:       2,
+		Backlog:    3000,
+		Drops:      4,
+		Requeues:   5,
+		Overlimits: 6,
+	}
+	if stats[2] != expected {
+		t.Errorf("unexpected stats for link 2: %+v", stats[2])
+	}
+
+	if stats[3].Packets != 1<<33 || stats[3].Bytes != 123456 {
+		t.Errorf("unexpected stats for link 3: %+v", stats[3])
+	}
+}
+
+func TestParseTcStats2Short(t *testing.T) {
+	b := nl.NewRtAttr(tcaStatsQueue, make([]byte, 8)).Serialize()
+	if _, err := parseTcStats2(b); err == nil {
+		t.Fatal("expected short queue stats to fail")
+	}
+}
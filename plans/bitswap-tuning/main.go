@@ -3,6 +3,7 @@ package main
 import (
 	test "github.com/ipfs/testground/plans/bitswap-tuning/test"
 	"github.com/ipfs/testground/sdk/runtime"
+	"github.com/ipfs/testground/sdk/sync"
 )
 
 var testCases = []func(*runtime.RunEnv) error{
@@ -10,7 +11,7 @@ var testCases = []func(*runtime.RunEnv) error{
 }
 
 func main() {
-	runtime.Invoke(run)
+	sync.Invoke(run)
 }
 
 func run(runenv *runtime.RunEnv) error {
@@ -11,9 +11,11 @@ require (
 	github.com/ipfs/interface-go-ipfs-core v0.2.3
 	github.com/ipfs/testground/sdk/iptb v0.0.0-00010101000000-000000000000
 	github.com/ipfs/testground/sdk/runtime v0.1.0
+	github.com/ipfs/testground/sdk/sync v0.1.0
 )
 
 replace (
 	github.com/ipfs/testground/sdk/iptb => ../../sdk/iptb
 	github.com/ipfs/testground/sdk/runtime => ../../sdk/runtime
+	github.com/ipfs/testground/sdk/sync => ../../sdk/sync
 )
@@ -8,6 +8,7 @@ import (
 	"github.com/ipfs/testground/plans/chew-datasets/utils"
 	"github.com/ipfs/testground/sdk/iptb"
 	"github.com/ipfs/testground/sdk/runtime"
+	"github.com/ipfs/testground/sdk/sync"
 )
 
 var testCases = []utils.TestCase{
@@ -21,7 +22,7 @@ var testCases = []utils.TestCase{
 }
 
 func main() {
-	runtime.Invoke(run)
+	sync.Invoke(run)
 }
 func run(runenv *runtime.RunEnv) error {
 	if runenv.TestCaseSeq < 0 {
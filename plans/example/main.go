@@ -5,10 +5,11 @@ import (
 	"fmt"
 
 	"github.com/ipfs/testground/sdk/runtime"
+	"github.com/ipfs/testground/sdk/sync"
 )
 
 func main() {
-	runtime.Invoke(run)
+	sync.Invoke(run)
 }
 
 // Pick a different example function to run
@@ -14,7 +14,7 @@ import (
 )
 
 func main() {
-	runtime.Invoke(run)
+	sync.Invoke(run)
 }
 
 func run(runenv *runtime.RunEnv) error {
@@ -68,7 +68,7 @@ func run(runenv *runtime.RunEnv) error {
 	}
 
 	runenv.RecordMessage("before writer config")
-	_, err = writer.Write(ctx, sync.NetworkSubtree(hostname), &config)
+	err = sync.ConfigureNetwork(ctx, watcher, writer, hostname, &config)
 	if err != nil {
 		return err
 	}
@@ -129,7 +129,7 @@ func run(runenv *runtime.RunEnv) error {
 	}
 
 	logging.S().Debug("before writing changed ip config to redis")
-	_, err = writer.Write(ctx, sync.NetworkSubtree(hostname), &config)
+	err = sync.ConfigureNetwork(ctx, watcher, writer, hostname, &config)
 	if err != nil {
 		return err
 	}
@@ -244,7 +244,7 @@ func run(runenv *runtime.RunEnv) error {
 	config.State = "latency-reduced"
 
 	logging.S().Debug("writing new config with latency reduced")
-	_, err = writer.Write(ctx, sync.NetworkSubtree(hostname), &config)
+	err = sync.ConfigureNetwork(ctx, watcher, writer, hostname, &config)
 	if err != nil {
 		return err
 	}
@@ -2,6 +2,12 @@ module github.com/ipfs/testground/plans/placebo
 
 go 1.13
 
-require github.com/ipfs/testground/sdk/runtime v0.0.0-00010101000000-000000000000
+require (
+	github.com/ipfs/testground/sdk/runtime v0.1.0
+	github.com/ipfs/testground/sdk/sync v0.1.0
+)
 
-replace github.com/ipfs/testground/sdk/runtime => ../../sdk/runtime
+replace (
+	github.com/ipfs/testground/sdk/runtime => ../../sdk/runtime
+	github.com/ipfs/testground/sdk/sync => ../../sdk/sync
+)
@@ -6,10 +6,11 @@ import (
 	"time"
 
 	"github.com/ipfs/testground/sdk/runtime"
+	"github.com/ipfs/testground/sdk/sync"
 )
 
 func main() {
-	runtime.Invoke(run)
+	sync.Invoke(run)
 }
 func run(runenv *runtime.RunEnv) error {
 	if runenv.TestCaseSeq < 0 {
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -21,6 +22,11 @@ const (
 	EnvTestRun                = "TEST_RUN"
 	EnvTestRepo               = "TEST_REPO"
 	EnvTestSubnet             = "TEST_SUBNET"
+	EnvTestSubnet6            = "TEST_SUBNET6"
+	EnvTestNAT                = "TEST_NAT"
+	EnvTestLinkStats          = "TEST_LINK_STATS"
+	EnvTestLinkStatsPublish   = "TEST_LINK_STATS_PUBLISH"
+	EnvTestCapture            = "TEST_CAPTURE"
 	EnvTestCaseSeq            = "TEST_CASE_SEQ"
 	EnvTestSidecar            = "TEST_SIDECAR"
 	EnvTestInstanceCount      = "TEST_INSTANCE_COUNT"
@@ -28,6 +34,7 @@ const (
 	EnvTestInstanceParams     = "TEST_INSTANCE_PARAMS"
 	EnvTestGroupID            = "TEST_GROUP_ID"
 	EnvTestGroupInstanceCount = "TEST_GROUP_INSTANCE_COUNT"
+	EnvTestGroupInstanceIndex = "TEST_GROUP_INSTANCE_INDEX"
 	EnvTestOutputsPath        = "TEST_OUTPUTS_PATH"
 )
 
@@ -61,6 +68,20 @@ func (i *IPNet) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// CaptureParams configure the packet capture the sidecar runs on the data link
+// of a test instance.
+type CaptureParams struct {
+	// Filter is a pcap filter expression; empty captures all packets.
+	Filter string `json:"filter,omitempty"`
+	// Snaplen is the number of bytes captured per packet.
+	Snaplen int `json:"snaplen"`
+	// MaxSize caps the size of the capture, in MB. The capture is split in
+	// Files files of MaxSize/Files MB each, which are rotated through as a
+	// ring buffer once they're all full.
+	MaxSize int `json:"max_size"`
+	Files   int `json:"files"`
+}
+
 // RunParams encapsulates the runtime parameters for this test.
 type RunParams struct {
 	TestPlan    string `json:"plan"`
@@ -82,9 +103,32 @@ type RunParams struct {
 	TestGroupID            string `json:"group,omitempty"`
 	TestGroupInstanceCount int    `json:"group_instances,omitempty"`
 
+	// The index of this instance within its group, as assigned by the
+	// runner. It's unique within the group, and stays the same when the
+	// instance is restarted. It starts at 0, except on cluster:swarm, where
+	// it's the slot of the service task, which starts at 1.
+	TestGroupInstanceIndex int `json:"group_instance_index"`
+
 	// true if the test has access to the sidecar.
 	TestSidecar bool `json:"test_sidecar,omitempty"`
 
+	// The type of NAT the sidecar puts this instance behind, as configured
+	// for its group; empty if none.
+	TestNAT string `json:"nat,omitempty"`
+
+	// The interval at which the sidecar samples the traffic statistics of the
+	// links of this instance, as configured for the runner; zero if it
+	// doesn't.
+	TestLinkStats time.Duration `json:"link_stats,omitempty"`
+
+	// true if the sidecar also publishes the link statistics samples to the
+	// sync service.
+	TestLinkStatsPublish bool `json:"link_stats_publish,omitempty"`
+
+	// The packet capture the sidecar runs on the data link of this instance,
+	// as configured for the runner; nil if none.
+	TestCapture *CaptureParams `json:"capture,omitempty"`
+
 	// The subnet on which this test is running.
 	//
 	// The test instance can use this to pick an IP address and/or determine
@@ -92,6 +136,10 @@ type RunParams struct {
 	//
 	// This will be 127.1.0.0/16 when using the local exec runner.
 	TestSubnet *IPNet `json:"network,omitempty"`
+
+	// The IPv6 subnet on which this test is running, if the runner was asked
+	// to enable IPv6 on the data network; nil otherwise.
+	TestSubnet6 *IPNet `json:"network6,omitempty"`
 }
 
 // RunEnv encapsulates the context for this test run.
@@ -157,9 +205,28 @@ func (re *RunParams) ToEnvVars() map[string]string {
 		EnvTestInstanceParams:     packParams(re.TestInstanceParams),
 		EnvTestGroupID:            re.TestGroupID,
 		EnvTestGroupInstanceCount: strconv.Itoa(re.TestGroupInstanceCount),
+		EnvTestGroupInstanceIndex: strconv.Itoa(re.TestGroupInstanceIndex),
 		EnvTestOutputsPath:        re.TestOutputsPath,
 	}
 
+	if re.TestNAT != "" {
+		out[EnvTestNAT] = re.TestNAT
+	}
+
+	if re.TestSubnet6 != nil {
+		out[EnvTestSubnet6] = re.TestSubnet6.String()
+	}
+
+	if re.TestCapture != nil {
+		b, _ := json.Marshal(re.TestCapture)
+		out[EnvTestCapture] = string(b)
+	}
+
+	if re.TestLinkStats > 0 {
+		out[EnvTestLinkStats] = re.TestLinkStats.String()
+		out[EnvTestLinkStatsPublish] = strconv.FormatBool(re.TestLinkStatsPublish)
+	}
+
 	return out
 }
 
@@ -189,6 +256,22 @@ func toBool(s string) bool {
 	return v
 }
 
+func toDuration(s string) time.Duration {
+	v, _ := time.ParseDuration(s)
+	return v
+}
+
+func toCapture(s string) *CaptureParams {
+	if s == "" {
+		return nil
+	}
+	var c CaptureParams
+	if err := json.Unmarshal([]byte(s), &c); err != nil {
+		return nil
+	}
+	return &c
+}
+
 // toNet might parse any input, so it is possible to get an error and nil return value
 func toNet(s string) *IPNet {
 	_, ipnet, err := net.ParseCIDR(s)
@@ -220,12 +303,18 @@ func ParseRunParams(env []string) (*RunParams, error) {
 		TestBranch:             m[EnvTestBranch],
 		TestRepo:               m[EnvTestRepo],
 		TestSubnet:             toNet(m[EnvTestSubnet]),
+		TestSubnet6:            toNet(m[EnvTestSubnet6]),
+		TestNAT:                m[EnvTestNAT],
+		TestLinkStats:          toDuration(m[EnvTestLinkStats]),
+		TestLinkStatsPublish:   toBool(m[EnvTestLinkStatsPublish]),
+		TestCapture:            toCapture(m[EnvTestCapture]),
 		TestCaseSeq:            toInt(m[EnvTestCaseSeq]),
 		TestInstanceCount:      toInt(m[EnvTestInstanceCount]),
 		TestInstanceRole:       m[EnvTestInstanceRole],
 		TestInstanceParams:     unpackParams(m[EnvTestInstanceParams]),
 		TestGroupID:            m[EnvTestGroupID],
 		TestGroupInstanceCount: toInt(m[EnvTestGroupInstanceCount]),
+		TestGroupInstanceIndex: toInt(m[EnvTestGroupInstanceIndex]),
 		TestOutputsPath:        m[EnvTestOutputsPath],
 	}, nil
 }
@@ -3,6 +3,7 @@ package runtime
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParseKeyValues(t *testing.T) {
@@ -69,3 +70,85 @@ func TestParseKeyValues(t *testing.T) {
 		})
 	}
 }
+
+func TestTestSubnet6(t *testing.T) {
+	params := RunParams{
+		TestSubnet: toNet("16.0.0.0/16"),
+	}
+
+	env := params.ToEnvVars()
+	if _, ok := env[EnvTestSubnet6]; ok {
+		t.Fatalf("expected %s to be unset when IPv6 is disabled", EnvTestSubnet6)
+	}
+
+	params.TestSubnet6 = toNet("fd74:6700:0:1::/64")
+	env = params.ToEnvVars()
+
+	var kvs []string
+	for k, v := range env {
+		kvs = append(kvs, k+"="+v)
+	}
+
+	parsed, err := ParseRunParams(kvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.TestSubnet6 == nil || parsed.TestSubnet6.String() != "fd74:6700:0:1::/64" {
+		t.Fatalf("unexpected IPv6 subnet: %v", parsed.TestSubnet6)
+	}
+}
+
+func TestTestLinkStats(t *testing.T) {
+	params := RunParams{
+		TestSubnet: toNet("16.0.0.0/16"),
+	}
+
+	env := params.ToEnvVars()
+	if _, ok := env[EnvTestLinkStats]; ok {
+		t.Fatalf("expected %s to be unset when link stats are disabled", EnvTestLinkStats)
+	}
+
+	params.TestLinkStats = 500 * time.Millisecond
+	params.TestLinkStatsPublish = true
+	env = params.ToEnvVars()
+
+	var kvs []string
+	for k, v := range env {
+		kvs = append(kvs, k+"="+v)
+	}
+
+	parsed, err := ParseRunParams(kvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.TestLinkStats != 500*time.Millisecond || !parsed.TestLinkStatsPublish {
+		t.Fatalf("unexpected link stats params: %s, %t", parsed.TestLinkStats, parsed.TestLinkStatsPublish)
+	}
+}
+
+func TestTestCapture(t *testing.T) {
+	params := RunParams{
+		TestSubnet: toNet("16.0.0.0/16"),
+	}
+
+	env := params.ToEnvVars()
+	if _, ok := env[EnvTestCapture]; ok {
+		t.Fatalf("expected %s to be unset when capture is disabled", EnvTestCapture)
+	}
+
+	params.TestCapture = &CaptureParams{Filter: "tcp[tcpflags] & tcp-syn != 0", Snaplen: 96, MaxSize: 100, Files: 4}
+	env = params.ToEnvVars()
+
+	var kvs []string
+	for k, v := range env {
+		kvs = append(kvs, k+"="+v)
+	}
+
+	parsed, err := ParseRunParams(kvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.TestCapture == nil || *parsed.TestCapture != *params.TestCapture {
+		t.Fatalf("unexpected capture params: %+v", parsed.TestCapture)
+	}
+}
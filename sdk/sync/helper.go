@@ -2,28 +2,87 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/ipfs/testground/sdk/runtime"
 )
 
-const (
-	// magic values that we monitor on the Testground runner side to detect when Testground
-	// testplan instances are initialised and at the stage of actually running a test
-	// check cluster_k8s.go for more information
-	NetworkInitialisationSuccessful = "network initialisation successful"
-	NetworkInitialisationFailed     = "network initialisation failed"
-)
-
-// WaitNetworkInitialized waits for the sidecar to initialize the network, if the sidecar is enabled.
+// WaitNetworkInitialized waits for the sidecar to initialize the network, if
+// the sidecar is enabled. The outcome is published on the run status subtree,
+// so runners can track it.
 func WaitNetworkInitialized(ctx context.Context, runenv *runtime.RunEnv, watcher *Watcher) error {
+	writer, err := NewWriter(ctx, runenv)
+	if err != nil {
+		// waiting for the network matters more than reporting it.
+		runenv.SLogger().Warnw("failed to create writer; not publishing run status", "err", err)
+	} else {
+		defer writer.Close()
+	}
+
+	publish := func(evt *InstanceEvent) {
+		if writer == nil {
+			return
+		}
+		if err := writer.PublishInstanceEvent(ctx, evt); err != nil {
+			runenv.SLogger().Warnw("failed to publish run status", "type", evt.Type, "err", err)
+		}
+	}
+
 	if runenv.TestSidecar {
 		err := <-watcher.Barrier(ctx, "network-initialized", int64(runenv.TestInstanceCount))
 		if err != nil {
-			runenv.RecordMessage(NetworkInitialisationFailed)
-			return fmt.Errorf("failed to initialize network: %w", err)
+			err = fmt.Errorf("failed to initialize network: %w", err)
+			publish(&InstanceEvent{Type: InstanceNetworkFailed, Error: err.Error()})
+			return err
 		}
 	}
-	runenv.RecordMessage(NetworkInitialisationSuccessful)
+	publish(&InstanceEvent{Type: InstanceNetworkReady})
 	return nil
 }
+
+// ConfigureNetwork asks the sidecar of the container with the given hostname
+// to apply a network configuration, and waits for it to be applied. It
+// returns the error the sidecar failed to apply it with, if any.
+//
+// It only waits for this container's sidecar; wait on cfg.State to know when
+// the networks of other instances are configured too.
+func ConfigureNetwork(ctx context.Context, watcher *Watcher, writer *Writer, hostname string, cfg *NetworkConfig) error {
+	seq, err := writer.Write(ctx, NetworkSubtree(hostname), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to write network configuration: %w", err)
+	}
+	return WaitNetworkResult(ctx, watcher, hostname, seq)
+}
+
+// WaitNetworkResult waits for the sidecar of the container with the given
+// hostname to process the network configuration request with sequence number
+// seq, as returned by Writer.Write. It returns the error the sidecar failed to
+// apply the configuration with, if any.
+func WaitNetworkResult(ctx context.Context, watcher *Watcher, hostname string, seq int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan *NetworkResult, 16)
+	if err := watcher.Subscribe(ctx, NetworkResultSubtree(hostname), ch); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case res, ok := <-ch:
+			if !ok {
+				return errors.New("subscription to network results closed")
+			}
+			if res.Seq != seq {
+				continue
+			}
+			if res.Error != "" {
+				return fmt.Errorf("sidecar failed to configure network %s: %s", res.Network, res.Error)
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
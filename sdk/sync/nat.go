@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NATType is the type of NAT a test instance is put behind on the data
+// network.
+type NATType int
+
+const (
+	// NATDefault puts the instance behind the NAT type configured for its
+	// group in the composition, if any.
+	NATDefault NATType = iota
+	// NATNone gives the instance a directly reachable address.
+	NATNone
+	// NATFullCone maps each internal port to the same external port for all
+	// destinations, and lets anyone reach mapped ports.
+	NATFullCone
+	// NATRestrictedCone maps ports like NATFullCone, but only lets in traffic
+	// from the addresses the instance has sent traffic to.
+	NATRestrictedCone
+	// NATPortRestrictedCone maps ports like NATFullCone, but only lets in
+	// traffic from the addresses and ports the instance has sent traffic to.
+	NATPortRestrictedCone
+	// NATSymmetric maps each connection to a random external port, and only
+	// lets in replies to it.
+	NATSymmetric
+)
+
+var natTypeNames = map[NATType]string{
+	NATNone:               "none",
+	NATFullCone:           "full-cone",
+	NATRestrictedCone:     "restricted-cone",
+	NATPortRestrictedCone: "port-restricted-cone",
+	NATSymmetric:          "symmetric",
+}
+
+// ParseNATType parses the name of a NAT type, as used in compositions. An
+// empty name stands for NATNone.
+func ParseNATType(s string) (NATType, error) {
+	if s == "" {
+		return NATNone, nil
+	}
+	names := make([]string, 0, len(natTypeNames))
+	for t := NATNone; t <= NATSymmetric; t++ {
+		if natTypeNames[t] == s {
+			return t, nil
+		}
+		names = append(names, natTypeNames[t])
+	}
+	return NATDefault, fmt.Errorf("unknown NAT type %q; must be one of: %s", s, strings.Join(names, ", "))
+}
+
+func (t NATType) String() string {
+	if name, ok := natTypeNames[t]; ok {
+		return name
+	}
+	return "default"
+}
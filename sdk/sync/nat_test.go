@@ -0,0 +1,22 @@
+package sync
+
+import "testing"
+
+func TestParseNATType(t *testing.T) {
+	for _, typ := range []NATType{NATNone, NATFullCone, NATRestrictedCone, NATPortRestrictedCone, NATSymmetric} {
+		parsed, err := ParseNATType(typ.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != typ {
+			t.Errorf("expected %s, got %s", typ, parsed)
+		}
+	}
+
+	if typ, err := ParseNATType(""); err != nil || typ != NATNone {
+		t.Errorf("expected an empty NAT type to stand for none, got %s, %v", typ, err)
+	}
+	if _, err := ParseNATType("cone"); err == nil {
+		t.Error("expected an unknown NAT type to be rejected")
+	}
+}
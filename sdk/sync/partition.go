@@ -0,0 +1,177 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"time"
+)
+
+// InstanceAddress is the address of a test instance on the data network.
+type InstanceAddress struct {
+	Hostname string
+	Group    string
+	IPv4     net.IP
+	IPv6     net.IP
+}
+
+// InstanceAddressSubtree represents a subtree where the sidecar of each test
+// instance publishes its address once the network is initialized, and every
+// time it changes.
+//
+// The sequence number of an instance is the position of its first entry in
+// this subtree, starting at 1. Use InstanceSeq to find it out.
+var InstanceAddressSubtree = &Subtree{
+	GroupKey:    "instance-addresses",
+	PayloadType: reflect.TypeOf(&InstanceAddress{}),
+	KeyFunc: func(val interface{}) string {
+		return val.(*InstanceAddress).Hostname
+	},
+}
+
+// PartitionSide is a set of test instances on one side of a partition.
+type PartitionSide struct {
+	// Groups are the IDs of the groups whose instances are on this side.
+	Groups []string
+
+	// Seqs are the sequence numbers of the instances on this side. See
+	// InstanceAddressSubtree.
+	Seqs []int64
+}
+
+// Contains returns whether the instance of a group with a sequence number is
+// on this side.
+func (s *PartitionSide) Contains(group string, seq int64) bool {
+	for _, g := range s.Groups {
+		if g == group {
+			return true
+		}
+	}
+	for _, sq := range s.Seqs {
+		if sq == seq {
+			return true
+		}
+	}
+	return false
+}
+
+// Partition splits test instances into sides that can't reach each other on
+// the data network. Instances on no side are not affected.
+//
+// Several instances may declare the same partition: identical declarations
+// are one and the same, and the sidecars apply it, and signal its State, once.
+type Partition struct {
+	// Name identifies the partition. Writing a partition replaces the one
+	// with the same name, if any, unless it's identical.
+	Name string
+
+	// Sides are the sides of the partition. Traffic between instances on
+	// different sides is dropped.
+	Sides []PartitionSide
+
+	// Healed heals the partition, letting instances reach each other again.
+	Healed bool
+
+	// After, if set, delays the partition.
+	After time.Duration
+
+	// Duration, if set, heals the partition once it's elapsed.
+	Duration time.Duration
+
+	// State will be signaled by the sidecar of every instance once the
+	// partition is applied, or healed if Healed is set. Sidecars that fail to
+	// apply it don't signal it, and publish a PartitionReport instead.
+	State State
+
+	// HealState will be signaled by the sidecar of every instance once the
+	// partition is healed after Duration.
+	HealState State
+}
+
+// PartitionSubtree represents a subtree through which test instances declare
+// partitions to the sidecars.
+var PartitionSubtree = &Subtree{
+	GroupKey:    "partitions",
+	PayloadType: reflect.TypeOf(&Partition{}),
+	KeyFunc: func(val interface{}) string {
+		return val.(*Partition).Name
+	},
+}
+
+// PartitionReport is the outcome of a change of a partition, published by the
+// sidecar of an instance once it's applied the partitions.
+type PartitionReport struct {
+	// Partition is the name of the partition that changed.
+	Partition string
+	// Dropped is the number of addresses the instance is cut off from.
+	Dropped int
+	// Error is set if the partitions couldn't be applied. The sidecar
+	// doesn't signal the State of the partition then.
+	Error string
+}
+
+// PartitionReportSubtree represents a subtree through which the sidecar of a
+// container reports the outcome of the changes of partitions.
+func PartitionReportSubtree(container string) *Subtree {
+	return &Subtree{
+		GroupKey:    "partition-report:" + container,
+		PayloadType: reflect.TypeOf(&PartitionReport{}),
+		KeyFunc: func(val interface{}) string {
+			return val.(*PartitionReport).Partition
+		},
+	}
+}
+
+// StartPartition declares a partition. Wait for its State, if any, with a
+// barrier on the instance count of the run to know when it's in place.
+func (w *Writer) StartPartition(ctx context.Context, p *Partition) error {
+	if p.Name == "" {
+		return errors.New("partition has no name")
+	}
+	if len(p.Sides) < 2 {
+		return fmt.Errorf("partition %s needs at least two sides", p.Name)
+	}
+
+	_, err := w.Write(ctx, PartitionSubtree, p)
+	return err
+}
+
+// HealPartition heals a partition. The sidecars will signal state, if not
+// empty, once it's healed.
+func (w *Writer) HealPartition(ctx context.Context, name string, state State) error {
+	_, err := w.Write(ctx, PartitionSubtree, &Partition{Name: name, Healed: true, State: state})
+	return err
+}
+
+// InstanceSeq returns the sequence number of the instance with the given
+// hostname, waiting for its sidecar to publish its address if it hasn't yet.
+func (w *Watcher) InstanceSeq(ctx context.Context, hostname string) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan *InstanceAddress, 16)
+	if err := w.Subscribe(ctx, InstanceAddressSubtree, ch); err != nil {
+		return 0, err
+	}
+
+	seen := make(map[string]bool)
+	for {
+		select {
+		case addr, ok := <-ch:
+			if !ok {
+				return 0, errors.New("subscription to instance addresses closed")
+			}
+			if seen[addr.Hostname] {
+				continue
+			}
+			seen[addr.Hostname] = true
+			if addr.Hostname == hostname {
+				return int64(len(seen)), nil
+			}
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
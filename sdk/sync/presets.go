@@ -1,8 +1,10 @@
 package sync
 
 import (
+	"fmt"
 	"net"
 	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -30,11 +32,17 @@ var PeerSubtree = &Subtree{
 	},
 }
 
+// FilterAction is the action applied to the traffic of a link, or to the
+// traffic to and from a subnet.
 type FilterAction int
 
 const (
+	// Accept lets traffic through.
 	Accept FilterAction = iota
+	// Reject refuses traffic: TCP connections are reset, and other packets
+	// are answered with ICMP port unreachable errors.
 	Reject
+	// Drop silently discards traffic, as if the peer was blackholed.
 	Drop
 )
 
@@ -49,8 +57,7 @@ type LinkShape struct {
 	// Bandwidth is egress bytes per second
 	Bandwidth uint64
 
-	// Drop all inbound traffic.
-	// TODO: Not implemented
+	// Filter is the action applied to inbound and outbound traffic.
 	Filter FilterAction
 
 	// Loss is the egress packet loss (%)
@@ -79,12 +86,30 @@ type LinkShape struct {
 	DuplicateCorr float32
 }
 
-// LinkRule applies a LinkShape to a subnet.
+// LinkRule applies a LinkShape to the egress traffic destined to a subnet.
 type LinkRule struct {
 	LinkShape
 	Subnet net.IPNet
 }
 
+// LinkStep is a step of a LinkSchedule: the shape that becomes the default
+// link shape Offset after the start of the schedule. Steps don't change the
+// filter of the link, so their Filter must be Accept.
+type LinkStep struct {
+	LinkShape
+	Offset time.Duration
+}
+
+// LinkSchedule varies the default link shape of a network over time.
+type LinkSchedule struct {
+	// Steps are applied in order, and must be sorted by Offset.
+	Steps []LinkStep
+
+	// Period, if non-zero, makes the schedule loop: it restarts every Period,
+	// which must be greater than the Offset of the last step.
+	Period time.Duration
+}
+
 // NetworkConfig specifies how a node's network should be configured.
 type NetworkConfig struct {
 	// Network is the name of the network to configure
@@ -97,7 +122,9 @@ type NetworkConfig struct {
 	// 16.0.0.1-32.0.0.0. X.Y.0.1 will always be reserved for the gateway
 	// and shouldn't be used by the test.
 	//
-	// TODO: IPv6 is currently not supported.
+	// If IPv6 is enabled on the data network, your test-case will also be
+	// assigned a /64 (TestSubnet6), whose ::1 address is reserved for the
+	// gateway. IPv6 addresses are only supported by the docker sidecar.
 	IPv4, IPv6 *net.IPNet
 
 	// Enable enables this network device.
@@ -106,10 +133,28 @@ type NetworkConfig struct {
 	// Default is the default link shaping rule.
 	Default LinkShape
 
-	// Rules defines how traffic should be shaped to different subnets.
-	// TODO: This is not implemented.
+	// Ingress, if set, shapes the inbound traffic of the link, whereas
+	// Default and Rules only shape the outbound traffic. Use it to model
+	// asymmetric links, e.g. a fast downlink and a slow uplink. Its Filter is
+	// ignored; filters set on Default and Rules apply in both directions.
+	//
+	// Unsetting it lifts the ingress shaping.
+	Ingress *LinkShape
+
+	// Rules defines how traffic should be shaped to different subnets,
+	// overriding Default. When subnets overlap, the most specific one wins.
 	Rules []LinkRule
 
+	// NAT is the type of NAT the instance is put behind on this network.
+	// NAT only applies to IPv4 traffic.
+	NAT NATType
+
+	// Schedule, if set, varies the default link shape over time, starting
+	// once the configuration is applied; Default applies until the first
+	// step. The schedule stops when a new configuration is written for the
+	// network. Each applied step is reported to LinkScheduleSubtree.
+	Schedule *LinkSchedule
+
 	// State will be signaled when the link changes are applied. Nodes can
 	// use the same state to wait for _all_ nodes to enter the desired
 	// network state.
@@ -128,3 +173,54 @@ func NetworkSubtree(container string) *Subtree {
 		},
 	}
 }
+
+// NetworkResult is the outcome of a network configuration request, published
+// by the sidecar once it's processed the request.
+type NetworkResult struct {
+	// Seq is the sequence number of the NetworkConfig within the
+	// NetworkSubtree of the container, as returned by Writer.Write.
+	Seq int64
+	// Network is the network the request configured.
+	Network string
+	// Error is set if the configuration couldn't be applied. The sidecar
+	// doesn't signal its State then.
+	Error string
+}
+
+// NetworkResultSubtree represents a subtree through which the sidecar
+// publishes the outcome of each network configuration request of a
+// container. Use ConfigureNetwork or WaitNetworkResult to wait for it.
+func NetworkResultSubtree(container string) *Subtree {
+	return &Subtree{
+		GroupKey:    "network-result:" + container,
+		PayloadType: reflect.TypeOf(&NetworkResult{}),
+		KeyFunc: func(val interface{}) string {
+			return strconv.FormatInt(val.(*NetworkResult).Seq, 10)
+		},
+	}
+}
+
+// LinkStepReport reports that the sidecar applied a step of a LinkSchedule.
+type LinkStepReport struct {
+	// Network is the network whose link was shaped.
+	Network string
+	// Step is the index of the step in the schedule.
+	Step int
+	// Loop is the number of times the schedule looped before this step.
+	Loop int
+	// Error is set if the step couldn't be applied.
+	Error string
+}
+
+// LinkScheduleSubtree represents a subtree through which the sidecar reports
+// the steps of link schedules it applies to the network of a container.
+func LinkScheduleSubtree(container string) *Subtree {
+	return &Subtree{
+		GroupKey:    "link-schedule:" + container,
+		PayloadType: reflect.TypeOf(&LinkStepReport{}),
+		KeyFunc: func(val interface{}) string {
+			r := val.(*LinkStepReport)
+			return fmt.Sprintf("%s-%d-%d", r.Network, r.Loop, r.Step)
+		},
+	}
+}
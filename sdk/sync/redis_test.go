@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -375,6 +376,98 @@ func TestRedisHost(t *testing.T) {
 	t.Fatal("redis address not found in list of addresses")
 }
 
+func TestRunStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	close := ensureRedis(t)
+	defer close()
+
+	runenv := randomRunEnv()
+
+	watcher, writer := MustWatcherWriter(ctx, runenv)
+	defer watcher.Close()
+	defer writer.Close()
+
+	ch := make(chan *InstanceEvent, 16)
+	if err := watcher.Subscribe(ctx, RunStatusSubtree, ch); err != nil {
+		t.Fatal(err)
+	}
+
+	events := []*InstanceEvent{
+		{Type: InstanceStarted},
+		{Type: InstanceNetworkReady},
+		{Type: InstanceFinished, Outcome: runtime.EventOutcomeFailed, Error: "boom"},
+	}
+	for _, evt := range events {
+		if err := writer.PublishInstanceEvent(ctx, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range events {
+		select {
+		case evt := <-ch:
+			if !reflect.DeepEqual(evt, expected) {
+				t.Fatalf("expected event %+v, got %+v", expected, evt)
+			}
+			if evt.GroupID != runenv.TestGroupID {
+				t.Fatalf("expected group %s, got %s", runenv.TestGroupID, evt.GroupID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received within 5 seconds")
+		}
+	}
+}
+
+func TestConfigureNetwork(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	close := ensureRedis(t)
+	defer close()
+
+	runenv := randomRunEnv()
+
+	watcher, writer := MustWatcherWriter(ctx, runenv)
+	defer watcher.Close()
+	defer writer.Close()
+
+	// play the sidecar: fail to apply the configurations of the "broken"
+	// network.
+	configs := make(chan *NetworkConfig, 16)
+	if err := watcher.Subscribe(ctx, NetworkSubtree("host"), configs); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		var seq int64
+		for cfg := range configs {
+			seq++
+			res := &NetworkResult{Seq: seq, Network: cfg.Network}
+			if cfg.Network == "broken" {
+				res.Error = "boom"
+			}
+			if _, err := writer.Write(ctx, NetworkResultSubtree("host"), res); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	if err := ConfigureNetwork(ctx, watcher, writer, "host", &NetworkConfig{Network: "default", Enable: true}); err != nil {
+		t.Fatalf("expected the configuration to be applied, got %s", err)
+	}
+
+	err := ConfigureNetwork(ctx, watcher, writer, "host", &NetworkConfig{Network: "broken", Enable: true})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected the sidecar's error, got %v", err)
+	}
+
+	if err := ConfigureNetwork(ctx, watcher, writer, "host", &NetworkConfig{Network: "default", Enable: true}); err != nil {
+		t.Fatalf("expected the configuration to be applied, got %s", err)
+	}
+}
+
 func consumeOrdered(t *testing.T, ctx context.Context, ch chan *string, values []string) {
 	t.Helper()
 
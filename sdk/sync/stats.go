@@ -0,0 +1,50 @@
+package sync
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// QdiscStats are the statistics of the traffic shaped by a link, as counted by
+// its root queueing discipline.
+type QdiscStats struct {
+	// Bytes and Packets count the traffic that went through.
+	Bytes   uint64 `json:"bytes"`
+	Packets uint64 `json:"packets"`
+	// Drops counts the packets dropped, including those lost on purpose.
+	Drops uint32 `json:"drops"`
+	// Overlimits counts the times packets were held back by the bandwidth
+	// limit.
+	Overlimits uint32 `json:"overlimits"`
+	// Requeues counts the packets put back in the queue by the device.
+	Requeues uint32 `json:"requeues"`
+	// Backlog and Qlen are the bytes and packets queued at sampling time.
+	Backlog uint32 `json:"backlog"`
+	Qlen    uint32 `json:"qlen"`
+}
+
+// LinkStats is a sample of the traffic statistics of the link of an instance
+// on a network. The counters are cumulative since the link was set up.
+type LinkStats struct {
+	Network string    `json:"network"`
+	Time    time.Time `json:"time"`
+	// Egress counts the outbound traffic of the link.
+	Egress QdiscStats `json:"egress"`
+	// Ingress counts the inbound traffic of the link, if it's shaped (see
+	// NetworkConfig.Ingress); nil otherwise.
+	Ingress *QdiscStats `json:"ingress,omitempty"`
+}
+
+// LinkStatsSubtree represents a subtree through which the sidecar publishes
+// the link statistics samples of a container, if the runner was asked to.
+func LinkStatsSubtree(container string) *Subtree {
+	return &Subtree{
+		GroupKey:    "link-stats:" + container,
+		PayloadType: reflect.TypeOf(&LinkStats{}),
+		KeyFunc: func(val interface{}) string {
+			s := val.(*LinkStats)
+			return s.Network + "-" + strconv.FormatInt(s.Time.UnixNano(), 10)
+		},
+	}
+}
@@ -0,0 +1,127 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/testground/sdk/runtime"
+)
+
+// InstanceEventType is the type of a lifecycle event published by a test
+// instance on the run status subtree.
+type InstanceEventType string
+
+const (
+	// InstanceStarted is published when the test case starts executing.
+	InstanceStarted = InstanceEventType("started")
+
+	// InstanceNetworkReady is published once the sidecar has initialised the
+	// network of the instance (or straight away if there's no sidecar).
+	InstanceNetworkReady = InstanceEventType("network_ready")
+
+	// InstanceNetworkFailed is published if the instance gave up waiting for
+	// the network to be initialised.
+	InstanceNetworkFailed = InstanceEventType("network_failed")
+
+	// InstanceFinished is published when the test case returns, carrying its
+	// outcome.
+	InstanceFinished = InstanceEventType("finished")
+)
+
+// InstanceEvent is a lifecycle event published by a test instance, so that
+// runners can track the progress of a run without scraping instance logs.
+type InstanceEvent struct {
+	Type    InstanceEventType    `json:"type"`
+	GroupID string               `json:"group_id"`
+	Outcome runtime.EventOutcome `json:"outcome,omitempty"`
+	Error   string               `json:"error,omitempty"`
+
+	// Instance identifies the instance that published the event, so that
+	// runners can tell the events of a restarted instance apart from those
+	// of other instances.
+	Instance string `json:"instance,omitempty"`
+}
+
+// RunStatusSubtree represents the subtree under the test run's sync tree where
+// test instances publish their lifecycle events.
+var RunStatusSubtree = &Subtree{
+	GroupKey:    "run_status",
+	PayloadType: reflect.TypeOf(&InstanceEvent{}),
+	KeyFunc: func(val interface{}) string {
+		return string(val.(*InstanceEvent).Type)
+	},
+}
+
+// PublishInstanceEvent publishes a lifecycle event of this instance on the run
+// status subtree. The group ID and the instance are populated from the RunEnv
+// if not set.
+func (w *Writer) PublishInstanceEvent(ctx context.Context, evt *InstanceEvent) error {
+	if evt.GroupID == "" {
+		evt.GroupID = w.re.TestGroupID
+	}
+	if evt.Instance == "" {
+		evt.Instance = instanceID(w.re)
+	}
+	_, err := w.Write(ctx, RunStatusSubtree, evt)
+	return err
+}
+
+// Invoke runs the passed test-case via runtime.Invoke, publishing the started
+// and finished lifecycle events of this instance on the run status subtree.
+//
+// If the sync service is unreachable, the test case runs regardless, and no
+// events are published.
+func Invoke(tc func(*runtime.RunEnv) error) {
+	runtime.Invoke(func(runenv *runtime.RunEnv) (err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		writer, werr := NewWriter(ctx, runenv)
+		if werr != nil {
+			runenv.SLogger().Warnw("failed to create writer; not publishing run status", "err", werr)
+			return tc(runenv)
+		}
+		defer writer.Close()
+
+		publish := func(evt *InstanceEvent) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := writer.PublishInstanceEvent(ctx, evt); err != nil {
+				runenv.SLogger().Warnw("failed to publish run status", "type", evt.Type, "err", err)
+			}
+		}
+
+		publish(&InstanceEvent{Type: InstanceStarted})
+
+		defer func() {
+			if r := recover(); r != nil {
+				publish(&InstanceEvent{
+					Type:    InstanceFinished,
+					Outcome: runtime.EventOutcomeCrashed,
+					Error:   fmt.Sprintf("%s", r),
+				})
+				panic(r)
+			}
+		}()
+
+		err = tc(runenv)
+
+		evt := &InstanceEvent{Type: InstanceFinished, Outcome: runtime.EventOutcomeOK}
+		if err != nil {
+			evt.Outcome, evt.Error = runtime.EventOutcomeFailed, err.Error()
+		}
+		publish(evt)
+		return err
+	})
+}
+
+// instanceID identifies this instance within its run, by its group and the
+// index the runner assigned it within the group, which survive restarts of
+// the instance.
+func instanceID(re *runtime.RunEnv) string {
+	return re.TestGroupID + "/" + strconv.Itoa(re.TestGroupInstanceIndex)
+}
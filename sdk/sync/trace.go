@@ -0,0 +1,93 @@
+package sync
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ParseLinkTrace parses a link trace into a looping LinkSchedule.
+//
+// A link trace is a CSV file in which every record holds a link shape for a
+// given time:
+//
+//     # duration (ms), bandwidth (bytes/s), latency (ms)[, loss (%)]
+//     1000,1048576,20
+//     500,131072,150,2.5
+//
+// A bandwidth of 0 leaves the bandwidth unlimited. Lines starting with # are
+// ignored. The schedule loops once all the records have been applied, i.e.
+// its period is the sum of their durations.
+func ParseLinkTrace(r io.Reader) (*LinkSchedule, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var (
+		sched  LinkSchedule
+		offset time.Duration
+	)
+
+	for n := 1; ; n++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid link trace: %w", err)
+		}
+
+		duration, step, err := parseTraceRecord(rec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid link trace record %d: %w", n, err)
+		}
+
+		step.Offset = offset
+		sched.Steps = append(sched.Steps, step)
+		offset += duration
+	}
+
+	if len(sched.Steps) == 0 {
+		return nil, errors.New("invalid link trace: no records")
+	}
+
+	sched.Period = offset
+	return &sched, nil
+}
+
+func parseTraceRecord(rec []string) (time.Duration, LinkStep, error) {
+	var step LinkStep
+
+	if len(rec) != 3 && len(rec) != 4 {
+		return 0, step, fmt.Errorf("expected 3 or 4 fields, got %d", len(rec))
+	}
+
+	ms, err := strconv.ParseUint(rec[0], 10, 32)
+	if err != nil || ms == 0 {
+		return 0, step, fmt.Errorf("invalid duration %q", rec[0])
+	}
+
+	if step.Bandwidth, err = strconv.ParseUint(rec[1], 10, 64); err != nil {
+		return 0, step, fmt.Errorf("invalid bandwidth %q", rec[1])
+	}
+
+	latency, err := strconv.ParseUint(rec[2], 10, 32)
+	if err != nil {
+		return 0, step, fmt.Errorf("invalid latency %q", rec[2])
+	}
+	step.Latency = time.Duration(latency) * time.Millisecond
+
+	if len(rec) == 4 {
+		loss, err := strconv.ParseFloat(rec[3], 32)
+		if err != nil || loss < 0 || loss > 100 {
+			return 0, step, fmt.Errorf("invalid loss %q", rec[3])
+		}
+		step.Loss = float32(loss)
+	}
+
+	return time.Duration(ms) * time.Millisecond, step, nil
+}
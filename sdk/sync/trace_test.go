@@ -0,0 +1,51 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLinkTrace(t *testing.T) {
+	trace := `# duration, bandwidth, latency, loss
+1000,1048576,20
+500, 131072, 150, 2.5
+`
+
+	sched, err := ParseLinkTrace(strings.NewReader(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sched.Period != 1500*time.Millisecond {
+		t.Fatalf("expected a period of 1.5s, got %s", sched.Period)
+	}
+
+	expected := []LinkStep{
+		{Offset: 0, LinkShape: LinkShape{Bandwidth: 1048576, Latency: 20 * time.Millisecond}},
+		{Offset: time.Second, LinkShape: LinkShape{Bandwidth: 131072, Latency: 150 * time.Millisecond, Loss: 2.5}},
+	}
+	if len(sched.Steps) != len(expected) {
+		t.Fatalf("expected %d steps, got %d", len(expected), len(sched.Steps))
+	}
+	for i, s := range sched.Steps {
+		if s != expected[i] {
+			t.Errorf("step %d: expected %+v, got %+v", i, expected[i], s)
+		}
+	}
+}
+
+func TestParseLinkTraceInvalid(t *testing.T) {
+	for _, trace := range []string{
+		"",
+		"# only comments\n",
+		"1000,1048576\n",
+		"0,1048576,20\n",
+		"1000,fast,20\n",
+		"1000,1048576,20,120\n",
+	} {
+		if _, err := ParseLinkTrace(strings.NewReader(trace)); err == nil {
+			t.Errorf("expected an error for trace %q", trace)
+		}
+	}
+}